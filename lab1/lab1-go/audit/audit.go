@@ -0,0 +1,184 @@
+package audit
+
+import (
+	"fmt"
+	"io"
+	"lab1-go/bank"
+	"sort"
+	"sync"
+)
+
+// Recorder is a bank.Observer keeping the opening balances and every
+// committed transfer.
+type Recorder struct {
+	mu         sync.Mutex
+	initial    map[int]int
+	currencies map[int]string
+	history    []bank.Commit
+	limits     []LimitChange
+}
+
+// LimitChange is an overdraft limit set on an account after the commit with
+// sequence After.
+type LimitChange struct {
+	After   uint64 `json:"after"`
+	Account int    `json:"account"`
+	Limit   int    `json:"limit"`
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{initial: make(map[int]int), currencies: make(map[int]string)}
+}
+
+func (r *Recorder) Opened(id int, currency string, balance int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.initial[id] = balance
+	r.currencies[id] = currency
+}
+
+func (r *Recorder) Committed(c bank.Commit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.history = append(r.history, c)
+}
+
+func (r *Recorder) LimitChanged(after uint64, id, limit int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits = append(r.limits, LimitChange{After: after, Account: id, Limit: limit})
+}
+
+// Trail returns a copy of what was recorded, history sorted by sequence.
+func (r *Recorder) Trail() Trail {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	trail := Trail{
+		Initial:    make(map[int]int, len(r.initial)),
+		Currencies: make(map[int]string, len(r.currencies)),
+		History:    append([]bank.Commit(nil), r.history...),
+		Limits:     append([]LimitChange(nil), r.limits...),
+	}
+	for id, balance := range r.initial {
+		trail.Initial[id] = balance
+		trail.Currencies[id] = r.currencies[id]
+	}
+	sort.Slice(trail.History, func(i, j int) bool { return trail.History[i].Seq < trail.History[j].Seq })
+	sort.SliceStable(trail.Limits, func(i, j int) bool { return trail.Limits[i].After < trail.Limits[j].After })
+	return trail
+}
+
+// Trail is an audit record: the opening balances and currencies, the
+// committed transfers in sequence order and the overdraft limit changes.
+// Final holds the balances the bank ended with, for verifying a saved trail
+// offline; the Recorder leaves it to the caller.
+type Trail struct {
+	Initial    map[int]int    `json:"initial"`
+	Currencies map[int]string `json:"currencies,omitempty"`
+	History    []bank.Commit  `json:"history"`
+	Limits     []LimitChange  `json:"limits,omitempty"`
+	Final      map[int]int    `json:"final,omitempty"`
+}
+
+type Discrepancy struct {
+	Account  int
+	Expected int
+	Actual   int
+}
+
+// Overdraft is a committed transfer that left an account below its overdraft
+// limit.
+type Overdraft struct {
+	Seq     uint64
+	TxID    uint64
+	Account int
+	Balance int
+}
+
+type Report struct {
+	Transfers     int
+	Discrepancies []Discrepancy
+	Overdrafts    []Overdraft
+	// Problems lists structural issues of the history itself: sequence
+	// gaps, unbalanced transfers and unknown accounts.
+	Problems []string
+}
+
+func (r Report) OK() bool {
+	return len(r.Discrepancies) == 0 && len(r.Overdrafts) == 0 && len(r.Problems) == 0
+}
+
+// Verify recomputes every account's balance from the trail, independently of
+// the bank, and compares it with the final balances.
+func Verify(trail Trail, final map[int]int) Report {
+	report := Report{Transfers: len(trail.History)}
+	balances := make(map[int]int, len(trail.Initial))
+	for id, balance := range trail.Initial {
+		balances[id] = balance
+	}
+
+	limits := make(map[int]int)
+	nextLimit := 0
+	var expectedSeq uint64 = 1
+	for _, c := range trail.History {
+		for ; nextLimit < len(trail.Limits) && trail.Limits[nextLimit].After < c.Seq; nextLimit++ {
+			limits[trail.Limits[nextLimit].Account] = trail.Limits[nextLimit].Limit
+		}
+		if c.Seq != expectedSeq {
+			report.Problems = append(report.Problems, fmt.Sprintf("sequence jumps from %d to %d", expectedSeq-1, c.Seq))
+		}
+		expectedSeq = c.Seq + 1
+
+		net := make(map[string]int)
+		for _, leg := range c.Legs {
+			net[trail.Currencies[leg.Account]] += leg.Amount
+			if _, ok := balances[leg.Account]; !ok {
+				report.Problems = append(report.Problems, fmt.Sprintf("transfer %d (seq %d) touches unknown account %d", c.TxID, c.Seq, leg.Account))
+			}
+			balances[leg.Account] += leg.Amount
+			if balances[leg.Account] < -limits[leg.Account] {
+				report.Overdrafts = append(report.Overdrafts, Overdraft{Seq: c.Seq, TxID: c.TxID, Account: leg.Account, Balance: balances[leg.Account]})
+			}
+		}
+		for currency, amount := range net {
+			if amount != 0 && !c.External {
+				report.Problems = append(report.Problems, fmt.Sprintf("transfer %d (seq %d) nets to %d %s", c.TxID, c.Seq, amount, currency))
+			}
+		}
+	}
+
+	ids := make([]int, 0, len(balances))
+	for id := range balances {
+		ids = append(ids, id)
+	}
+	for id := range final {
+		if _, ok := balances[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if balances[id] != final[id] {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{Account: id, Expected: balances[id], Actual: final[id]})
+		}
+	}
+	return report
+}
+
+// PrintReport writes the per-account discrepancies, the overdrafts and the
+// problems of r to w.
+func PrintReport(w io.Writer, r Report) {
+	fmt.Fprintf(w, "Audit: replayed %d committed transfers\n", r.Transfers)
+	for _, d := range r.Discrepancies {
+		fmt.Fprintf(w, "Account %d: expected %d, found %d\n", d.Account, d.Expected, d.Actual)
+	}
+	for _, o := range r.Overdrafts {
+		fmt.Fprintf(w, "Transfer %d (seq %d) overdrew account %d to %d\n", o.TxID, o.Seq, o.Account, o.Balance)
+	}
+	for _, p := range r.Problems {
+		fmt.Fprintln(w, p)
+	}
+	if r.OK() {
+		fmt.Fprintln(w, "Audit passed")
+	}
+}
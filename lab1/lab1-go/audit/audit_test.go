@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"lab1-go/bank"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifySavedTrail(t *testing.T) {
+	legs := func(from, to, amount int) []bank.Leg {
+		return []bank.Leg{{Account: from, Amount: -amount}, {Account: to, Amount: amount}}
+	}
+	tests := []struct {
+		name          string
+		history       []bank.Commit
+		final         map[int]int
+		discrepancies int
+		overdrafts    int
+		problems      int
+	}{
+		{
+			name:    "balanced",
+			history: []bank.Commit{{Seq: 1, TxID: 1, Legs: legs(1, 2, 30)}, {Seq: 2, TxID: 2, Legs: legs(2, 1, 10)}},
+			final:   map[int]int{1: 80, 2: 70},
+		},
+		{
+			name:          "money on the wrong account",
+			history:       []bank.Commit{{Seq: 1, TxID: 1, Legs: legs(1, 2, 30)}},
+			final:         map[int]int{1: 70, 2: 40, 3: 10},
+			discrepancies: 2,
+		},
+		{
+			name:       "overdraft",
+			history:    []bank.Commit{{Seq: 1, TxID: 1, Legs: legs(1, 2, 150)}},
+			final:      map[int]int{1: -50, 2: 200},
+			overdrafts: 1,
+		},
+		{
+			name:     "sequence gap",
+			history:  []bank.Commit{{Seq: 2, TxID: 1, Legs: legs(1, 2, 30)}},
+			final:    map[int]int{1: 70, 2: 80},
+			problems: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "trail.json")
+			trail := Trail{Initial: map[int]int{1: 100, 2: 50, 3: 0}, History: tt.history, Final: tt.final}
+			if err := trail.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := LoadTrail(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := Verify(loaded, loaded.Final)
+			if len(r.Discrepancies) != tt.discrepancies || len(r.Overdrafts) != tt.overdrafts || len(r.Problems) != tt.problems {
+				t.Errorf("got %+v", r)
+			}
+			if r.OK() != (tt.discrepancies+tt.overdrafts+tt.problems == 0) {
+				t.Errorf("OK() = %v", r.OK())
+			}
+		})
+	}
+}
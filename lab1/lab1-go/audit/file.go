@@ -0,0 +1,24 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+)
+
+func (t Trail) Save(path string) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func LoadTrail(path string) (Trail, error) {
+	var t Trail
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return t, err
+	}
+	err = json.Unmarshal(data, &t)
+	return t, err
+}
@@ -0,0 +1,135 @@
+package bank
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type BankAccount struct {
+	ID       int
+	Currency string
+	Balance  int
+	Ch       chan Transaction
+	mu       sync.Mutex
+	// limit is how far Balance may go below zero.
+	limit int
+	// held is the part of Balance reserved by authorization holds.
+	held int
+	// version is bumped by every change of Balance, limit or held.
+	version uint64
+	metrics accountMetrics
+}
+
+// Start runs the account worker: every transfer is queued on both accounts
+// and the two legs meet on otherTxDoneCh. The worker exits when Ch is closed
+// or stop is cancelled.
+func (account *BankAccount) Start(stop context.Context, maxDelay time.Duration, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			var tran Transaction
+			var ok bool
+			select {
+			case tran, ok = <-account.Ch:
+				if !ok {
+					return
+				}
+			case <-stop.Done():
+				return
+			}
+			account.metrics.observeQueueDepth(len(account.Ch) + 1)
+			if tran.Legs == nil && account.ID == tran.From {
+				tran.ledger.metrics.QueueWait.ObserveSince(tran.queuedAt)
+			}
+
+			if maxDelay > 0 && !sleep(tran.ctx, time.Duration(rand.Int63n(int64(maxDelay)))) {
+				continue
+			}
+			if tran.Legs != nil {
+				account.join(tran)
+			} else if account.ID == tran.From {
+				account.withdraw(tran)
+			} else if account.ID == tran.To {
+				account.deposit(tran)
+			}
+		}
+	}()
+}
+
+func (account *BankAccount) withdraw(tran Transaction) {
+	if !tran.claim() {
+		return
+	}
+	status := StatusInsufficientFunds
+	if available, _ := account.read(); available >= tran.Amount {
+		if tran.record(RecordPrepare) == nil {
+			account.commit(tran)
+			return
+		}
+		status = StatusFailed
+	}
+	select {
+	case tran.otherTxDoneCh <- false:
+	case <-tran.ctx.Done():
+	}
+	tran.resultCh <- status
+}
+
+// commit applies both legs once the destination has agreed; the destination
+// worker waits on appliedCh so it never runs ahead of its own credit.
+func (account *BankAccount) commit(tran Transaction) {
+	start := time.Now()
+	select {
+	case tran.otherTxDoneCh <- true:
+		tran.ledger.metrics.Handshake.ObserveSince(start)
+		status := tran.ledger.transfer(tran)
+		close(tran.appliedCh)
+		tran.resultCh <- status
+	case <-tran.ctx.Done():
+		tran.record(RecordAbort)
+		tran.resultCh <- StatusCancelled
+	}
+}
+
+func (account *BankAccount) deposit(tran Transaction) {
+	select {
+	case success := <-tran.otherTxDoneCh:
+		if success {
+			<-tran.appliedCh
+		}
+	case <-tran.ctx.Done():
+	}
+}
+
+func (account *BankAccount) balance() int {
+	account.mu.Lock()
+	defer account.mu.Unlock()
+	return account.Balance
+}
+
+// available is what the account can still spend: its balance and overdraft
+// limit less the holds. The caller holds mu.
+func (account *BankAccount) available() int {
+	return account.Balance + account.limit - account.held
+}
+
+// read returns the available funds and the version they were read at.
+func (account *BankAccount) read() (int, uint64) {
+	account.mu.Lock()
+	defer account.mu.Unlock()
+	return account.available(), account.version
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
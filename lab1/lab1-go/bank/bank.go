@@ -0,0 +1,391 @@
+package bank
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrClosed            = errors.New("bank is closed")
+	ErrUnknownAccount    = errors.New("unknown account")
+	ErrInvalidAmount     = errors.New("invalid amount")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
+
+type EngineKind string
+
+const (
+	// EngineChannel runs one worker goroutine per account; the two legs of a
+	// transfer meet over a channel.
+	EngineChannel EngineKind = "channel"
+	// EngineLock locks both accounts in ID order on the caller's goroutine.
+	EngineLock EngineKind = "lock"
+	// EngineOptimistic validates account versions at commit and retries on
+	// conflict.
+	EngineOptimistic EngineKind = "optimistic"
+)
+
+var Engines = []EngineKind{EngineChannel, EngineLock, EngineOptimistic}
+
+type Config struct {
+	Engine EngineKind
+	// MaxDelay is the upper bound of the random processing delay the channel
+	// engine adds before each leg.
+	MaxDelay  time.Duration
+	QueueSize int
+	// TransferTimeout bounds every transfer on top of the caller's context.
+	TransferTimeout time.Duration
+	// LogPath enables the write-ahead transaction log; an existing log is
+	// replayed to rebuild the accounts.
+	LogPath string
+	SyncLog bool
+	// Observer, if set, sees every account opening and committed transfer.
+	Observer Observer
+	// Currency denominates the accounts opened by OpenAccount; it defaults
+	// to DefaultCurrency.
+	Currency string
+}
+
+const DefaultCurrency = "USD"
+
+// engine moves money between accounts owned by a Bank.
+type engine interface {
+	open(acc *BankAccount)
+	transfer(ctx context.Context, id uint64, key string, from, to *BankAccount, amount int) (Result, error)
+	transferMulti(tran Transaction) Status
+	close()
+}
+
+type Bank struct {
+	mu       sync.RWMutex
+	accounts map[int]*BankAccount
+	nextID   int
+	nextTxID atomic.Uint64
+	closed   bool
+	inflight sync.WaitGroup
+
+	// stop is cancelled when a shutdown gives up waiting; every transfer
+	// context derives from it.
+	stop       context.Context
+	cancelStop context.CancelFunc
+	timeout    time.Duration
+	currency   string
+
+	ledger    ledger
+	recovered *RecoveredState
+
+	fx        fx
+	engine    engine
+	scheduler *scheduler
+	stats     stats
+}
+
+func NewBank(cfg Config) (*Bank, error) {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 64
+	}
+	if cfg.Currency == "" {
+		cfg.Currency = DefaultCurrency
+	}
+	b := &Bank{accounts: make(map[int]*BankAccount), nextID: 1, timeout: cfg.TransferTimeout, currency: cfg.Currency}
+	b.nextTxID.Store(1)
+	b.ledger.observer = cfg.Observer
+	b.ledger.metrics = newBankMetrics()
+	b.ledger.holds = make(map[uint64]Hold)
+	b.ledger.deposited = make(map[string]*atomic.Int64)
+	b.fx.rates = make(map[[2]string]float64)
+	b.fx.houses = make(map[string]int)
+	b.scheduler = newScheduler(b.runScheduled)
+
+	if cfg.LogPath != "" {
+		if err := b.recover(cfg.LogPath, cfg.SyncLog); err != nil {
+			return nil, err
+		}
+	}
+
+	b.stop, b.cancelStop = context.WithCancel(context.Background())
+	switch cfg.Engine {
+	case "", EngineChannel:
+		b.engine = newChannelEngine(b.stop, &b.ledger, cfg)
+	case EngineLock:
+		b.engine = newLockEngine(&b.ledger)
+	case EngineOptimistic:
+		b.engine = newOptimisticEngine(&b.ledger)
+	default:
+		b.cancelStop()
+		if b.ledger.log != nil {
+			b.ledger.log.Close()
+		}
+		return nil, fmt.Errorf("unknown engine %q", cfg.Engine)
+	}
+
+	for _, id := range b.Accounts() {
+		b.ledger.open(b.accounts[id])
+		b.engine.open(b.accounts[id])
+	}
+	if b.recovered != nil {
+		for _, sched := range b.recovered.Scheduled {
+			b.scheduler.add(sched)
+		}
+	}
+	return b, nil
+}
+
+// recover rebuilds the accounts from the log at path, cuts off a torn last
+// record, records an abort for every transfer left half-applied and keeps
+// the log open for appending.
+func (b *Bank) recover(path string, sync bool) error {
+	state, err := Recover(path)
+	if err != nil {
+		return err
+	}
+	if err := truncateLog(path, state.LogSize); err != nil {
+		return err
+	}
+	log, err := OpenLog(path, sync)
+	if err != nil {
+		return err
+	}
+	for _, id := range state.RolledBack {
+		if err := log.Append(Record{Type: RecordAbort, TxID: id}); err != nil {
+			log.Close()
+			return err
+		}
+	}
+
+	for id, balance := range state.Balances {
+		currency := state.Currencies[id]
+		if currency == "" {
+			currency = b.currency
+		}
+		b.accounts[id] = &BankAccount{ID: id, Currency: currency, Balance: balance, limit: state.Limits[id]}
+	}
+	for currency, id := range state.Houses {
+		b.fx.houses[currency] = id
+	}
+	for id, h := range state.Holds {
+		b.accounts[h.Account].held += h.Amount
+		b.ledger.holds[id] = h
+	}
+	b.nextID = state.NextID
+	b.nextTxID.Store(state.NextTxID)
+	b.ledger.log = log
+	b.recovered = state
+	return nil
+}
+
+// Recovered returns what was rebuilt from the transaction log, or nil when
+// the bank started without one.
+func (b *Bank) Recovered() *RecoveredState {
+	return b.recovered
+}
+
+// OpenAccount creates a new account in the bank's currency and returns its ID.
+func (b *Bank) OpenAccount(initialBalance int) (int, error) {
+	return b.openAccount(b.currency, initialBalance, false)
+}
+
+// OpenAccountIn creates a new account denominated in currency.
+func (b *Bank) OpenAccountIn(currency string, initialBalance int) (int, error) {
+	if currency == "" {
+		return 0, ErrUnknownCurrency
+	}
+	return b.openAccount(currency, initialBalance, false)
+}
+
+func (b *Bank) openAccount(currency string, initialBalance int, house bool) (int, error) {
+	if initialBalance < 0 {
+		return 0, ErrInvalidAmount
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, ErrClosed
+	}
+	if house {
+		if err := b.fx.claimHouse(currency, b.nextID); err != nil {
+			return 0, err
+		}
+	}
+
+	acc := &BankAccount{ID: b.nextID, Currency: currency, Balance: initialBalance}
+	if b.ledger.log != nil {
+		rec := Record{Type: RecordOpen, Account: acc.ID, Balance: initialBalance, Currency: currency, House: house}
+		if err := b.ledger.log.Append(rec); err != nil {
+			if house {
+				b.fx.dropHouse(currency)
+			}
+			return 0, err
+		}
+	}
+	b.nextID++
+	b.accounts[acc.ID] = acc
+	b.ledger.open(acc)
+	b.engine.open(acc)
+	return acc.ID, nil
+}
+
+// Transfer moves amount from one account to another and blocks until both
+// legs are done. The returned Result always carries the final status; the
+// error is non-nil for every status other than StatusCommitted.
+func (b *Bank) Transfer(ctx context.Context, from, to, amount int) (Result, error) {
+	return b.TransferWithKey(ctx, "", from, to, amount)
+}
+
+// TransferWithKey is Transfer with the caller's idempotency key, which is
+// written to the transaction log with the transfer. After a restart the
+// keys of the committed transfers are in Recovered().Keys, so a retry can
+// be answered without moving the money again.
+func (b *Bank) TransferWithKey(ctx context.Context, key string, from, to, amount int) (Result, error) {
+	res, err := b.transfer(ctx, key, from, to, amount)
+	b.stats.record(res.Status)
+	return res, err
+}
+
+func (b *Bank) transfer(ctx context.Context, key string, from, to, amount int) (Result, error) {
+	res := Result{From: from, To: to, Amount: amount}
+	if amount < 0 || from == to {
+		res.Status = StatusInvalid
+		return res, ErrInvalidAmount
+	}
+	if err := ctx.Err(); err != nil {
+		res.Status = StatusCancelled
+		return res, err
+	}
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		res.Status = StatusCancelled
+		return res, ErrClosed
+	}
+	fromAcc, okFrom := b.accounts[from]
+	toAcc, okTo := b.accounts[to]
+	if !okFrom || !okTo {
+		b.mu.RUnlock()
+		res.Status = StatusUnknownAccount
+		return res, ErrUnknownAccount
+	}
+	if fromAcc.Currency != toAcc.Currency {
+		b.mu.RUnlock()
+		res.Status = StatusInvalid
+		return res, ErrCurrencyMismatch
+	}
+	b.inflight.Add(1)
+	b.mu.RUnlock()
+	defer b.inflight.Done()
+
+	ctx, cancel := b.transferContext(ctx)
+	defer cancel()
+	res, err := b.engine.transfer(ctx, b.nextTxID.Add(1)-1, key, fromAcc, toAcc, amount)
+	if err == nil {
+		err = res.err()
+	}
+	return res, err
+}
+
+// transferContext derives the context of a single transfer: it ends with the
+// caller's context, the configured timeout or a forced shutdown.
+func (b *Bank) transferContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	var cancel context.CancelFunc
+	if b.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	stopAfter := context.AfterFunc(b.stop, cancel)
+	return ctx, func() {
+		stopAfter()
+		cancel()
+	}
+}
+
+func (b *Bank) Balance(id int) (int, error) {
+	b.mu.RLock()
+	acc, ok := b.accounts[id]
+	b.mu.RUnlock()
+	if !ok {
+		return 0, ErrUnknownAccount
+	}
+	return acc.balance(), nil
+}
+
+// Accounts returns the IDs of all open accounts in ascending order.
+func (b *Bank) Accounts() []int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	ids := make([]int, 0, len(b.accounts))
+	for id := range b.accounts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Snapshot returns a consistent cut of all balances: transfers still in
+// flight are either fully included or not at all.
+func (b *Bank) Snapshot() Snapshot {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	accounts := make([]*BankAccount, 0, len(b.accounts))
+	for _, acc := range b.accounts {
+		accounts = append(accounts, acc)
+	}
+	return b.ledger.snapshot(accounts)
+}
+
+func (b *Bank) Total() int {
+	return b.Snapshot().Total
+}
+
+// Stats returns the outcome counts of all transfers submitted so far.
+func (b *Bank) Stats() Stats {
+	return b.stats.snapshot()
+}
+
+// Close waits for the transfers in flight and stops the engine.
+func (b *Bank) Close() {
+	b.Shutdown(context.Background())
+}
+
+// Shutdown stops accepting transfers, leaves scheduled transfers that are not
+// due yet pending and waits for the ones in flight. If ctx
+// ends first the remaining transfers are cancelled on both legs and the
+// account workers are stopped; the context error is returned.
+func (b *Bank) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+	b.scheduler.stop()
+
+	drained := make(chan struct{})
+	go func() {
+		b.inflight.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+		b.cancelStop()
+		<-drained
+	}
+	b.scheduler.wg.Wait()
+	b.engine.close()
+	b.cancelStop()
+	if b.ledger.log != nil {
+		b.ledger.log.Close()
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package bank
+
+import (
+	"math"
+	"sort"
+)
+
+// AccountState is what a batch job sees of one account.
+type AccountState struct {
+	ID       int
+	Currency string
+	Balance  int
+	Held     int
+	Limit    int
+}
+
+// JobFunc returns the amount a batch job credits to (positive) or debits from
+// (negative) one account. It runs while the whole bank is locked, so it must
+// be fast and must not call back into the Bank.
+type JobFunc func(acc AccountState) int
+
+// Interest credits rate times every positive balance, rounded down.
+func Interest(rate float64) JobFunc {
+	return func(acc AccountState) int {
+		if acc.Balance <= 0 {
+			return 0
+		}
+		return int(math.Floor(float64(acc.Balance) * rate))
+	}
+}
+
+// Fee debits amount from every account.
+func Fee(amount int) JobFunc {
+	return func(AccountState) int {
+		return -amount
+	}
+}
+
+// JobResult is the effect of a batch job.
+type JobResult struct {
+	ID   uint64
+	Name string
+	// Legs has one leg per account the job changed, in account order.
+	Legs []Leg
+	// Capped counts the debits cut down to what the account had available.
+	Capped int
+	// Totals is the money the job brought into the bank per currency;
+	// negative for fees. The expected totals of later snapshots include it.
+	Totals map[string]int
+	Total  int
+	Status Status
+}
+
+// RunJob applies fn to every open account at a single cut: each transfer is
+// applied either entirely before the job or entirely after it and every
+// account is changed exactly once. Transfers keep queueing meanwhile and
+// carry on as soon as the job is done. A debit never takes an account past
+// its overdraft limit; it is cut down to the available funds instead.
+//
+// The job is logged and observed as one external commit with name as its
+// reference, so recovery replays it and audits account for it.
+func (b *Bank) RunJob(name string, fn JobFunc) (JobResult, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return JobResult{Name: name, Status: StatusCancelled}, ErrClosed
+	}
+	accounts := make([]*BankAccount, 0, len(b.accounts))
+	for _, acc := range b.accounts {
+		accounts = append(accounts, acc)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+
+	tran := Transaction{ID: b.nextTxID.Add(1) - 1, Ref: name, external: true, ledger: &b.ledger}
+	res := b.ledger.runJob(tran, accounts, fn)
+	return res, res.err()
+}
+
+func (l *ledger) runJob(tran Transaction, accounts []*BankAccount, fn JobFunc) JobResult {
+	l.cut.Lock()
+	defer l.cut.Unlock()
+	lockAll(accounts)
+	defer unlockAll(accounts)
+
+	res := JobResult{ID: tran.ID, Name: tran.Ref, Totals: make(map[string]int)}
+	for _, acc := range accounts {
+		amount := fn(AccountState{ID: acc.ID, Currency: acc.Currency, Balance: acc.Balance, Held: acc.held, Limit: acc.limit})
+		if amount < 0 && acc.available()+amount < 0 {
+			amount = -max(acc.available(), 0)
+			res.Capped++
+		}
+		if amount != 0 {
+			tran.Legs = append(tran.Legs, Leg{Account: acc.ID, Amount: amount})
+			tran.accounts = append(tran.accounts, acc)
+		}
+	}
+	res.Legs = tran.Legs
+	if len(tran.Legs) == 0 {
+		res.Status = StatusCommitted
+		return res
+	}
+
+	if tran.record(RecordPrepare) != nil || tran.record(RecordCommit) != nil {
+		res.Status = StatusFailed
+		return res
+	}
+	for i, leg := range tran.Legs {
+		acc := tran.accounts[i]
+		acc.Balance += leg.Amount
+		acc.version++
+		l.deposited[acc.Currency].Add(int64(leg.Amount))
+		res.Totals[acc.Currency] += leg.Amount
+		res.Total += leg.Amount
+	}
+	if l.observer != nil {
+		l.observer.Committed(Commit{Seq: l.seq.Add(1), TxID: tran.ID, Legs: tran.Legs, External: true, Ref: tran.Ref})
+	}
+	res.Status = StatusCommitted
+	return res
+}
+
+func (r JobResult) err() error {
+	return Result{Status: r.Status}.err()
+}
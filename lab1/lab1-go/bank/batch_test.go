@@ -0,0 +1,135 @@
+package bank
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestRunJobSingleCut runs jobs while transfers keep moving money around:
+// every job must see the accounts between two whole transfers and change
+// each of them exactly once.
+func TestRunJobSingleCut(t *testing.T) {
+	for _, engine := range Engines {
+		t.Run(string(engine), func(t *testing.T) {
+			b := newTestBank(t, Config{Engine: engine})
+			defer b.Close()
+			ids := make([]int, 10)
+			for i := range ids {
+				ids[i], _ = b.OpenAccount(1000)
+			}
+
+			done := make(chan struct{})
+			var wg sync.WaitGroup
+			for c := range 4 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					rng := rand.New(rand.NewSource(int64(c)))
+					for {
+						select {
+						case <-done:
+							return
+						default:
+						}
+						perm := rng.Perm(len(ids))
+						_, err := b.Transfer(context.Background(), ids[perm[0]], ids[perm[1]], 1+rng.Intn(100))
+						if err != nil && !errors.Is(err, ErrInsufficientFunds) {
+							t.Error(err)
+						}
+					}
+				}()
+			}
+
+			expected := 10 * 1000
+			for job := range 20 {
+				seen, visits := 0, make(map[int]int)
+				fn := func(acc AccountState) int {
+					seen += acc.Balance
+					visits[acc.ID]++
+					return 1 + job%3
+				}
+				res, err := b.RunJob("credit", fn)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if seen != expected {
+					t.Fatalf("job %d saw a total of %d, want %d", job, seen, expected)
+				}
+				if len(visits) != len(ids) || len(res.Legs) != len(ids) {
+					t.Fatalf("job %d visited %d accounts and changed %d, want %d", job, len(visits), len(res.Legs), len(ids))
+				}
+				for id, n := range visits {
+					if n != 1 {
+						t.Fatalf("job %d visited account %d %d times", job, id, n)
+					}
+				}
+				if res.Total != len(ids)*(1+job%3) || res.Totals[DefaultCurrency] != res.Total {
+					t.Fatalf("job %d reported %d (%v)", job, res.Total, res.Totals)
+				}
+				expected += res.Total
+			}
+			close(done)
+			wg.Wait()
+
+			snap := b.Snapshot()
+			if err := snap.Validate(); err != nil || snap.Total != expected || snap.Expected != expected {
+				t.Errorf("total %d, expected %d, want %d: %v", snap.Total, snap.Expected, expected, err)
+			}
+		})
+	}
+}
+
+func TestRunJobFeeCapped(t *testing.T) {
+	cfg := Config{LogPath: filepath.Join(t.TempDir(), "wal")}
+	b := newTestBank(t, cfg)
+	rich, _ := b.OpenAccount(100)
+	poor, _ := b.OpenAccount(3)
+	empty, _ := b.OpenAccount(0)
+	held, _ := b.OpenAccount(10)
+	overdraft, _ := b.OpenAccount(0)
+	b.Hold(held, 8, "")
+	b.SetOverdraftLimit(overdraft, 20)
+	before := b.Snapshot()
+
+	res, err := b.RunJob("monthly fee", Fee(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int{rich: 95, poor: 0, empty: 0, held: 8, overdraft: -5}
+	for id, balance := range want {
+		if got, _ := b.Balance(id); got != balance {
+			t.Errorf("account %d: balance %d, want %d", id, got, balance)
+		}
+	}
+	if res.Capped != 3 || res.Total != -5-3-2-5 || len(res.Legs) != 4 {
+		t.Errorf("capped %d, total %d, legs %v", res.Capped, res.Total, res.Legs)
+	}
+	after := b.Snapshot()
+	if err := after.Validate(); err != nil || after.Total != before.Total+res.Total {
+		t.Errorf("total %d after a job of %d from %d: %v", after.Total, res.Total, before.Total, err)
+	}
+
+	// Interest only goes to positive balances and is rounded down.
+	res, _ = b.RunJob("interest", Interest(0.1))
+	if res.Total != 9 || res.Capped != 0 || len(res.Legs) != 1 {
+		t.Errorf("interest: total %d, legs %v", res.Total, res.Legs)
+	}
+	b.Close()
+
+	// Recovery replays both jobs.
+	b = newTestBank(t, cfg)
+	defer b.Close()
+	want[rich] = 104
+	for id, balance := range want {
+		if got, _ := b.Balance(id); got != balance {
+			t.Errorf("after a restart account %d: balance %d, want %d", id, got, balance)
+		}
+	}
+	if snap := b.Snapshot(); snap.Total != after.Total+9 {
+		t.Errorf("after a restart total %d, want %d", snap.Total, after.Total+9)
+	}
+}
@@ -0,0 +1,89 @@
+package bank
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// channelEngine is the original lab design: one goroutine per account
+// consuming BankAccount.Ch.
+type channelEngine struct {
+	stop      context.Context
+	ledger    *ledger
+	maxDelay  time.Duration
+	queueSize int
+
+	// submitMu keeps both legs of every transfer in the same global order on
+	// all account queues, otherwise two workers can wait on each other.
+	submitMu sync.Mutex
+	accounts []*BankAccount
+	wg       sync.WaitGroup
+}
+
+func newChannelEngine(stop context.Context, ledger *ledger, cfg Config) *channelEngine {
+	return &channelEngine{stop: stop, ledger: ledger, maxDelay: cfg.MaxDelay, queueSize: cfg.QueueSize}
+}
+
+func (e *channelEngine) open(acc *BankAccount) {
+	acc.Ch = make(chan Transaction, e.queueSize)
+	e.accounts = append(e.accounts, acc)
+	acc.Start(e.stop, e.maxDelay, &e.wg)
+}
+
+func (e *channelEngine) transfer(ctx context.Context, id uint64, key string, from, to *BankAccount, amount int) (Result, error) {
+	res := Result{ID: id, From: from.ID, To: to.ID, Amount: amount}
+	tran := Transaction{
+		ID:            id,
+		From:          from.ID,
+		To:            to.ID,
+		Amount:        amount,
+		Key:           key,
+		ctx:           ctx,
+		from:          from,
+		to:            to,
+		state:         new(atomic.Int32),
+		ledger:        e.ledger,
+		otherTxDoneCh: make(chan bool),
+		appliedCh:     make(chan struct{}),
+		resultCh:      make(chan Status, 1),
+	}
+
+	tran.queuedAt = time.Now()
+	e.submitMu.Lock()
+	queued := enqueue(ctx, from.Ch, tran) && enqueue(ctx, to.Ch, tran)
+	e.submitMu.Unlock()
+
+	if queued {
+		select {
+		case res.Status = <-tran.resultCh:
+			return res, nil
+		case <-ctx.Done():
+		}
+	}
+	if tran.abandon() {
+		res.Status = StatusCancelled
+		return res, ctx.Err()
+	}
+	// the source leg already owns the transfer and reports promptly once
+	// the context is done
+	res.Status = <-tran.resultCh
+	return res, nil
+}
+
+func enqueue(ctx context.Context, ch chan Transaction, tran Transaction) bool {
+	select {
+	case ch <- tran:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (e *channelEngine) close() {
+	for _, acc := range e.accounts {
+		close(acc.Ch)
+	}
+	e.wg.Wait()
+}
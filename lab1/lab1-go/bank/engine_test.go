@@ -0,0 +1,119 @@
+package bank
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// seededTransfers runs n random transfers between accounts one after the
+// other and returns their statuses and the final balances.
+func seededTransfers(t *testing.T, b *Bank, seed int64, accounts, n int) ([]Status, []int) {
+	t.Helper()
+	rng := rand.New(rand.NewSource(seed))
+	ids := make([]int, accounts)
+	for i := range ids {
+		ids[i], _ = b.OpenAccount(rng.Intn(200))
+	}
+	statuses := make([]Status, n)
+	for i := range statuses {
+		from, to := ids[rng.Intn(accounts)], ids[rng.Intn(accounts)]
+		if from == to {
+			to = ids[(slices.Index(ids, from)+1)%accounts]
+		}
+		res, _ := b.Transfer(context.Background(), from, to, 1+rng.Intn(150))
+		statuses[i] = res.Status
+	}
+	balances := make([]int, accounts)
+	for i, id := range ids {
+		balances[i], _ = b.Balance(id)
+	}
+	return statuses, balances
+}
+
+func TestEnginesAgree(t *testing.T) {
+	const seed, accounts, n = 42, 8, 2000
+	reference := newTestBank(t, Config{Engine: EngineChannel})
+	defer reference.Close()
+	want, wantBalances := seededTransfers(t, reference, seed, accounts, n)
+	if !slices.Contains(want, StatusInsufficientFunds) || !slices.Contains(want, StatusCommitted) {
+		t.Fatal("the workload should both commit and run out of funds")
+	}
+	for _, engine := range Engines[1:] {
+		t.Run(string(engine), func(t *testing.T) {
+			b := newTestBank(t, Config{Engine: engine})
+			defer b.Close()
+			got, balances := seededTransfers(t, b, seed, accounts, n)
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("transfer %d: %v, the channel engine got %v", i, got[i], want[i])
+				}
+			}
+			if !slices.Equal(balances, wantBalances) {
+				t.Errorf("balances %v, the channel engine left %v", balances, wantBalances)
+			}
+		})
+	}
+}
+
+func TestEnginesConcurrent(t *testing.T) {
+	for _, engine := range Engines {
+		t.Run(string(engine), func(t *testing.T) {
+			b := newTestBank(t, Config{Engine: engine})
+			defer b.Close()
+			ids := make([]int, 6)
+			for i := range ids {
+				ids[i], _ = b.OpenAccount(100)
+			}
+			var wg sync.WaitGroup
+			for c := range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					rng := rand.New(rand.NewSource(int64(c)))
+					for range 300 {
+						from, to := rng.Intn(len(ids)), rng.Intn(len(ids)-1)
+						if to >= from {
+							to++
+						}
+						res, err := b.Transfer(context.Background(), ids[from], ids[to], 1+rng.Intn(80))
+						if !res.Committed() && !errors.Is(err, ErrInsufficientFunds) {
+							t.Errorf("transfer: %v, %v", res.Status, err)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			snap := b.Snapshot()
+			if err := snap.Validate(); err != nil || snap.Total != 600 {
+				t.Errorf("total %d, %v", snap.Total, err)
+			}
+			stats := b.Stats()
+			if stats.Submitted != 8*300 || stats.Committed+stats.InsufficientFunds != stats.Submitted {
+				t.Errorf("stats %+v", stats)
+			}
+		})
+	}
+}
+
+func TestEnginesCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, engine := range Engines {
+		t.Run(string(engine), func(t *testing.T) {
+			b := newTestBank(t, Config{Engine: engine})
+			defer b.Close()
+			a1, _ := b.OpenAccount(100)
+			a2, _ := b.OpenAccount(0)
+			if res, err := b.Transfer(ctx, a1, a2, 10); res.Status != StatusCancelled || !errors.Is(err, context.Canceled) {
+				t.Errorf("got %v, %v", res.Status, err)
+			}
+			if got, _ := b.Balance(a1); got != 100 {
+				t.Errorf("balance %d after a cancelled transfer", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package bank
+
+import "context"
+
+// Deposit brings money into the bank. ref is recorded in the transaction log
+// and the commit so callers can tell after a crash whether it was applied.
+func (b *Bank) Deposit(ctx context.Context, id, amount int, ref string) (MultiResult, error) {
+	return b.adjust(ctx, id, amount, amount, ref)
+}
+
+// Withdraw takes money out of the bank; like a transfer it fails if the
+// account lacks the funds.
+func (b *Bank) Withdraw(ctx context.Context, id, amount int, ref string) (MultiResult, error) {
+	return b.adjust(ctx, id, amount, -amount, ref)
+}
+
+func (b *Bank) adjust(ctx context.Context, id, amount, delta int, ref string) (MultiResult, error) {
+	legs := []Leg{{Account: id, Amount: delta}}
+	if amount <= 0 {
+		res := MultiResult{Legs: legs, Status: StatusInvalid}
+		b.stats.record(res.Status)
+		return res, ErrInvalidAmount
+	}
+	res, err := b.submitLegs(ctx, Transaction{Legs: legs, Ref: ref, external: true})
+	b.stats.record(res.Status)
+	return res, err
+}
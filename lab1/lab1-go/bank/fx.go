@@ -0,0 +1,186 @@
+package bank
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrCurrencyMismatch = errors.New("accounts are in different currencies")
+	ErrNoRate           = errors.New("no exchange rate")
+	ErrNoHouse          = errors.New("no FX house account")
+)
+
+// fx holds the exchange rates and the FX house account of every currency.
+// A conversion pays into the house account of the source currency and out
+// of the house account of the target currency, so every currency keeps its
+// own total.
+type fx struct {
+	mu     sync.RWMutex
+	rates  map[[2]string]float64
+	houses map[string]int
+}
+
+func (f *fx) claimHouse(currency string, id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.houses[currency]; ok {
+		return fmt.Errorf("%s already has an FX house account", currency)
+	}
+	f.houses[currency] = id
+	return nil
+}
+
+func (f *fx) dropHouse(currency string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.houses, currency)
+}
+
+// quote returns the rate from one currency to another and both house
+// accounts.
+func (f *fx) quote(from, to string) (rate float64, fromHouse, toHouse int, err error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	rate, ok := f.rates[[2]string{from, to}]
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("%w from %s to %s", ErrNoRate, from, to)
+	}
+	fromHouse, okFrom := f.houses[from]
+	toHouse, okTo := f.houses[to]
+	if !okFrom || !okTo {
+		return 0, 0, 0, ErrNoHouse
+	}
+	return rate, fromHouse, toHouse, nil
+}
+
+func (f *fx) isHouse(id int) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, house := range f.houses {
+		if house == id {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenHouse opens the FX house account of currency with the liquidity it can
+// pay out of conversions into that currency.
+func (b *Bank) OpenHouse(currency string, balance int) (int, error) {
+	if currency == "" {
+		return 0, ErrUnknownCurrency
+	}
+	return b.openAccount(currency, balance, true)
+}
+
+// Houses returns the FX house account of every currency.
+func (b *Bank) Houses() map[string]int {
+	b.fx.mu.RLock()
+	defer b.fx.mu.RUnlock()
+	houses := make(map[string]int, len(b.fx.houses))
+	for currency, id := range b.fx.houses {
+		houses[currency] = id
+	}
+	return houses
+}
+
+// SetRate sets how many units of to one unit of from buys. Rates can change
+// while transfers run; a conversion uses the rate it was submitted with.
+func (b *Bank) SetRate(from, to string, rate float64) error {
+	if from == "" || to == "" || from == to {
+		return ErrUnknownCurrency
+	}
+	if !(rate > 0) || math.IsInf(rate, 0) {
+		return fmt.Errorf("%w: rate %v", ErrInvalidAmount, rate)
+	}
+	b.fx.mu.Lock()
+	defer b.fx.mu.Unlock()
+	b.fx.rates[[2]string{from, to}] = rate
+	return nil
+}
+
+func (b *Bank) Rate(from, to string) (float64, bool) {
+	b.fx.mu.RLock()
+	defer b.fx.mu.RUnlock()
+	rate, ok := b.fx.rates[[2]string{from, to}]
+	return rate, ok
+}
+
+// FXResult is the outcome of a conversion: amount left the source account
+// and Converted, rounded down, reached the target account.
+type FXResult struct {
+	MultiResult
+	Rate      float64
+	Converted int
+}
+
+// Convert moves amount from an account to one in another currency at the
+// current rate. All four legs, through both FX house accounts, are applied
+// atomically.
+func (b *Bank) Convert(ctx context.Context, from, to, amount int) (FXResult, error) {
+	res, err := b.convert(ctx, from, to, amount)
+	b.stats.record(res.Status)
+	return res, err
+}
+
+func (b *Bank) convert(ctx context.Context, from, to, amount int) (FXResult, error) {
+	res := FXResult{MultiResult: MultiResult{Status: StatusInvalid}}
+	if amount <= 0 || from == to {
+		return res, ErrInvalidAmount
+	}
+	b.mu.RLock()
+	fromAcc, okFrom := b.accounts[from]
+	toAcc, okTo := b.accounts[to]
+	b.mu.RUnlock()
+	if !okFrom || !okTo {
+		res.Status = StatusUnknownAccount
+		return res, ErrUnknownAccount
+	}
+	if fromAcc.Currency == toAcc.Currency {
+		return res, fmt.Errorf("%w: both accounts are in %s", ErrInvalidAmount, fromAcc.Currency)
+	}
+	if b.fx.isHouse(from) || b.fx.isHouse(to) {
+		return res, fmt.Errorf("%w: FX house accounts do not convert", ErrInvalidAmount)
+	}
+
+	rate, fromHouse, toHouse, err := b.fx.quote(fromAcc.Currency, toAcc.Currency)
+	if err != nil {
+		return res, err
+	}
+	res.Rate = rate
+	res.Converted = int(math.Floor(float64(amount) * rate))
+	if res.Converted <= 0 {
+		return res, fmt.Errorf("%w: %d %s converts to nothing", ErrInvalidAmount, amount, fromAcc.Currency)
+	}
+
+	legs := []Leg{
+		{Account: from, Amount: -amount},
+		{Account: fromHouse, Amount: amount},
+		{Account: toHouse, Amount: -res.Converted},
+		{Account: to, Amount: res.Converted},
+	}
+	sort.Slice(legs, func(i, j int) bool { return legs[i].Account < legs[j].Account })
+	res.MultiResult, err = b.submitLegs(ctx, Transaction{Legs: legs})
+	return res, err
+}
+
+// balancedPerCurrency reports whether the legs of a transfer net to zero in
+// every currency.
+func balancedPerCurrency(legs []Leg, accounts []*BankAccount) bool {
+	net := make(map[string]int)
+	for i, leg := range legs {
+		net[accounts[i].Currency] += leg.Amount
+	}
+	for _, amount := range net {
+		if amount != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package bank
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConvert(t *testing.T) {
+	for _, engine := range Engines {
+		t.Run(string(engine), func(t *testing.T) {
+			b := newTestBank(t, Config{Engine: engine})
+			defer b.Close()
+			usd, _ := b.OpenAccount(100)
+			eur, _ := b.OpenAccountIn("EUR", 0)
+			usdHouse, _ := b.OpenHouse("USD", 0)
+			eurHouse, _ := b.OpenHouse("EUR", 100)
+			if err := b.SetRate("USD", "EUR", 0.9); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := b.Convert(context.Background(), usd, eur, 51)
+			if !res.Committed() || err != nil || res.Converted != 45 {
+				t.Fatalf("convert: %v, converted %d, %v", res.Status, res.Converted, err)
+			}
+			want := map[int]int{usd: 49, usdHouse: 51, eurHouse: 55, eur: 45}
+			for id, balance := range want {
+				if got, _ := b.Balance(id); got != balance {
+					t.Errorf("account %d: balance %d, want %d", id, got, balance)
+				}
+			}
+
+			if res, err := b.Convert(context.Background(), usd, eur, 49); res.Converted != 44 || !res.Committed() {
+				t.Errorf("second convert: %v, converted %d, %v", res.Status, res.Converted, err)
+			}
+			if _, err := b.Convert(context.Background(), usd, eur, 1); !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("converting to nothing: %v", err)
+			}
+			b.SetRate("USD", "EUR", 100)
+			if _, err := b.Convert(context.Background(), usdHouse, eur, 1); !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("converting out of a house account: %v", err)
+			}
+			if _, err := b.Deposit(context.Background(), usd, 10, "top-up"); err != nil {
+				t.Fatal(err)
+			}
+			// The EUR house cannot pay out 1000 EUR: no leg is applied.
+			if res, err := b.Convert(context.Background(), usd, eur, 10); res.Status != StatusInsufficientFunds || !errors.Is(err, ErrInsufficientFunds) {
+				t.Errorf("draining the EUR house: %v, %v", res.Status, err)
+			}
+			if got, _ := b.Balance(usd); got != 10 {
+				t.Errorf("balance %d after a rejected conversion, want 10", got)
+			}
+			if _, err := b.Convert(context.Background(), eur, usd, 10); !errors.Is(err, ErrNoRate) {
+				t.Errorf("without a rate: %v", err)
+			}
+
+			snap := b.Snapshot()
+			if err := snap.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if snap.Totals["USD"] != 110 || snap.Totals["EUR"] != 100 {
+				t.Errorf("totals %v, want 110 USD and 100 EUR", snap.Totals)
+			}
+		})
+	}
+}
+
+func TestCrossCurrencyTransferRejected(t *testing.T) {
+	b := newTestBank(t, Config{})
+	defer b.Close()
+	usd, _ := b.OpenAccount(100)
+	eur, _ := b.OpenAccountIn("EUR", 100)
+	usd2, _ := b.OpenAccount(0)
+
+	if res, err := b.Transfer(context.Background(), usd, eur, 10); res.Status != StatusInvalid || !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("transfer: %v, %v", res.Status, err)
+	}
+	legs := []Leg{{usd, -10}, {eur, 5}, {usd2, 5}}
+	if res, err := b.TransferMulti(context.Background(), legs); res.Status != StatusInvalid || !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("multi-leg transfer: %v, %v", res.Status, err)
+	}
+	if _, err := b.Schedule(time.Now(), usd, eur, 10); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("scheduled transfer: %v", err)
+	}
+	if _, err := b.Convert(context.Background(), usd, usd2, 10); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("converting within a currency: %v", err)
+	}
+	if _, err := b.Convert(context.Background(), usd, eur, 10); !errors.Is(err, ErrNoRate) {
+		t.Errorf("converting without a rate: %v", err)
+	}
+	b.SetRate("USD", "EUR", 1)
+	if _, err := b.Convert(context.Background(), usd, eur, 10); !errors.Is(err, ErrNoHouse) {
+		t.Errorf("converting without house accounts: %v", err)
+	}
+	for id, want := range map[int]int{usd: 100, eur: 100, usd2: 0} {
+		if got, _ := b.Balance(id); got != want {
+			t.Errorf("account %d: balance %d, want %d", id, got, want)
+		}
+	}
+}
+
+func TestSnapshotValidatePerCurrency(t *testing.T) {
+	valid := Snapshot{
+		Balances:       map[int]int{1: 60, 2: 40, 3: 70},
+		Currencies:     map[int]string{1: "USD", 2: "USD", 3: "EUR"},
+		Totals:         map[string]int{"USD": 100, "EUR": 70},
+		ExpectedTotals: map[string]int{"USD": 100, "EUR": 70},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	// Ten USD turned into ten EUR: the grand total still adds up.
+	skewed := valid
+	skewed.Totals = map[string]int{"USD": 90, "EUR": 80}
+	err := skewed.Validate()
+	if err == nil || !strings.Contains(err.Error(), "EUR") {
+		t.Errorf("money moved across currencies: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package bank
+
+import (
+	"errors"
+	"sort"
+)
+
+var ErrUnknownHold = errors.New("unknown hold")
+
+// Hold reserves part of an account's funds: they stay in its balance, and so
+// in every total, but cannot be spent until the hold is released.
+type Hold struct {
+	ID      uint64 `json:"id"`
+	Account int    `json:"account"`
+	Amount  int    `json:"amount"`
+	Ref     string `json:"ref,omitempty"`
+}
+
+// LimitObserver may be implemented by an Observer that also wants overdraft
+// limit changes. after is the Seq of the last commit before the change; it
+// runs with the account locked.
+type LimitObserver interface {
+	LimitChanged(after uint64, id, limit int)
+}
+
+// AccountInfo is the state of a single account.
+type AccountInfo struct {
+	ID        int    `json:"id"`
+	Currency  string `json:"currency"`
+	Balance   int    `json:"balance"`
+	Held      int    `json:"held"`
+	Limit     int    `json:"limit"`
+	Available int    `json:"available"`
+}
+
+func (b *Bank) Account(id int) (AccountInfo, error) {
+	b.mu.RLock()
+	acc, ok := b.accounts[id]
+	b.mu.RUnlock()
+	if !ok {
+		return AccountInfo{}, ErrUnknownAccount
+	}
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	return AccountInfo{ID: id, Currency: acc.Currency, Balance: acc.Balance, Held: acc.held, Limit: acc.limit, Available: acc.available()}, nil
+}
+
+// acquire looks up the accounts of an operation that bypasses the engine and
+// counts it as in flight; the caller must call b.inflight.Done once it is
+// done.
+func (b *Bank) acquire(ids ...int) ([]*BankAccount, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	accounts := make([]*BankAccount, len(ids))
+	for i, id := range ids {
+		acc, ok := b.accounts[id]
+		if !ok {
+			return nil, ErrUnknownAccount
+		}
+		accounts[i] = acc
+	}
+	b.inflight.Add(1)
+	return accounts, nil
+}
+
+// SetOverdraftLimit lets the balance of an account go down to -limit. Lowering
+// the limit below what the account already uses fails with
+// ErrInsufficientFunds.
+func (b *Bank) SetOverdraftLimit(id, limit int) error {
+	if limit < 0 {
+		return ErrInvalidAmount
+	}
+	accounts, err := b.acquire(id)
+	if err != nil {
+		return err
+	}
+	defer b.inflight.Done()
+	return b.ledger.setLimit(accounts[0], limit)
+}
+
+// Hold reserves amount of the account's available funds.
+func (b *Bank) Hold(id, amount int, ref string) (Hold, error) {
+	if amount <= 0 {
+		return Hold{}, ErrInvalidAmount
+	}
+	accounts, err := b.acquire(id)
+	if err != nil {
+		return Hold{}, err
+	}
+	defer b.inflight.Done()
+	h := Hold{ID: b.nextTxID.Add(1) - 1, Account: id, Amount: amount, Ref: ref}
+	if err := b.ledger.hold(accounts[0], h); err != nil {
+		return Hold{}, err
+	}
+	return h, nil
+}
+
+// Capture transfers amount of the held funds to another account and releases
+// the rest of the hold. It is recorded in Stats like any transfer.
+func (b *Bank) Capture(holdID uint64, to, amount int) (Result, error) {
+	res, err := b.capture(holdID, to, amount)
+	b.stats.record(res.Status)
+	return res, err
+}
+
+func (b *Bank) capture(holdID uint64, to, amount int) (Result, error) {
+	res := Result{To: to, Amount: amount}
+	h, ok := b.ledger.lookupHold(holdID)
+	if !ok {
+		res.Status = StatusInvalid
+		return res, ErrUnknownHold
+	}
+	res.From = h.Account
+	if amount <= 0 || amount > h.Amount || to == h.Account {
+		res.Status = StatusInvalid
+		return res, ErrInvalidAmount
+	}
+	accounts, err := b.acquire(h.Account, to)
+	if errors.Is(err, ErrUnknownAccount) {
+		res.Status = StatusUnknownAccount
+		return res, err
+	} else if err != nil {
+		res.Status = StatusCancelled
+		return res, err
+	}
+	defer b.inflight.Done()
+	if accounts[0].Currency != accounts[1].Currency {
+		res.Status = StatusInvalid
+		return res, ErrCurrencyMismatch
+	}
+
+	res.ID = b.nextTxID.Add(1) - 1
+	tran := newDirectTransaction(res.ID, accounts[0], accounts[1], amount, &b.ledger)
+	res.Status, err = b.ledger.capture(tran, holdID)
+	if err == nil {
+		err = res.err()
+	}
+	return res, err
+}
+
+// Release gives the held funds back to the account.
+func (b *Bank) Release(holdID uint64) error {
+	h, ok := b.ledger.lookupHold(holdID)
+	if !ok {
+		return ErrUnknownHold
+	}
+	accounts, err := b.acquire(h.Account)
+	if err != nil {
+		return err
+	}
+	defer b.inflight.Done()
+	return b.ledger.release(accounts[0], holdID)
+}
+
+// Holds returns the open holds ordered by ID.
+func (b *Bank) Holds() []Hold {
+	b.ledger.holdsMu.Lock()
+	defer b.ledger.holdsMu.Unlock()
+	holds := make([]Hold, 0, len(b.ledger.holds))
+	for _, h := range b.ledger.holds {
+		holds = append(holds, h)
+	}
+	sort.Slice(holds, func(i, j int) bool { return holds[i].ID < holds[j].ID })
+	return holds
+}
+
+func (l *ledger) setLimit(acc *BankAccount, limit int) error {
+	l.cut.RLock()
+	defer l.cut.RUnlock()
+	acc.lockTimed()
+	defer acc.mu.Unlock()
+	if acc.Balance+limit-acc.held < 0 {
+		return ErrInsufficientFunds
+	}
+	if l.log != nil {
+		if err := l.log.Append(Record{Type: RecordLimit, Account: acc.ID, Limit: limit}); err != nil {
+			return err
+		}
+	}
+	acc.limit = limit
+	acc.version++
+	if o, ok := l.observer.(LimitObserver); ok {
+		o.LimitChanged(l.seq.Load(), acc.ID, limit)
+	}
+	return nil
+}
+
+func (l *ledger) lookupHold(id uint64) (Hold, bool) {
+	l.holdsMu.Lock()
+	defer l.holdsMu.Unlock()
+	h, ok := l.holds[id]
+	return h, ok
+}
+
+// takeHold removes the hold; the caller holds the lock of its account, so a
+// concurrent capture or release of the same hold finds it gone.
+func (l *ledger) takeHold(id uint64) (Hold, bool) {
+	l.holdsMu.Lock()
+	defer l.holdsMu.Unlock()
+	h, ok := l.holds[id]
+	delete(l.holds, id)
+	return h, ok
+}
+
+func (l *ledger) hold(acc *BankAccount, h Hold) error {
+	l.cut.RLock()
+	defer l.cut.RUnlock()
+	acc.lockTimed()
+	defer acc.mu.Unlock()
+	if acc.available() < h.Amount {
+		return ErrInsufficientFunds
+	}
+	if l.log != nil {
+		if err := l.log.Append(Record{Type: RecordHold, TxID: h.ID, Account: h.Account, Amount: h.Amount, Ref: h.Ref}); err != nil {
+			return err
+		}
+	}
+	acc.held += h.Amount
+	acc.version++
+	l.holdsMu.Lock()
+	l.holds[h.ID] = h
+	l.holdsMu.Unlock()
+	return nil
+}
+
+// capture moves tran.Amount of the hold from tran.from to tran.to in a single
+// log record; the funds were reserved, so it cannot lack them.
+func (l *ledger) capture(tran Transaction, holdID uint64) (Status, error) {
+	l.cut.RLock()
+	defer l.cut.RUnlock()
+	lockPair(tran.from, tran.to)
+	defer unlockPair(tran.from, tran.to)
+
+	h, ok := l.takeHold(holdID)
+	if !ok {
+		return StatusInvalid, ErrUnknownHold
+	}
+	if l.log != nil {
+		rec := Record{Type: RecordCapture, TxID: tran.ID, Hold: holdID, From: tran.From, To: tran.To, Amount: tran.Amount}
+		if err := l.log.Append(rec); err != nil {
+			l.holdsMu.Lock()
+			l.holds[holdID] = h
+			l.holdsMu.Unlock()
+			return StatusFailed, nil
+		}
+	}
+	tran.from.held -= h.Amount
+	tran.from.Balance -= tran.Amount
+	tran.to.Balance += tran.Amount
+	tran.from.version++
+	tran.to.version++
+	tran.from.metrics.transfers.Add(1)
+	tran.to.metrics.transfers.Add(1)
+	if l.observer != nil {
+		l.observer.Committed(Commit{Seq: l.seq.Add(1), TxID: tran.ID, Legs: []Leg{
+			{Account: tran.From, Amount: -tran.Amount},
+			{Account: tran.To, Amount: tran.Amount},
+		}, Ref: h.Ref})
+	}
+	return StatusCommitted, nil
+}
+
+func (l *ledger) release(acc *BankAccount, holdID uint64) error {
+	l.cut.RLock()
+	defer l.cut.RUnlock()
+	acc.lockTimed()
+	defer acc.mu.Unlock()
+
+	h, ok := l.takeHold(holdID)
+	if !ok {
+		return ErrUnknownHold
+	}
+	if l.log != nil {
+		if err := l.log.Append(Record{Type: RecordRelease, TxID: holdID}); err != nil {
+			l.holdsMu.Lock()
+			l.holds[holdID] = h
+			l.holdsMu.Unlock()
+			return err
+		}
+	}
+	acc.held -= h.Amount
+	acc.version++
+	return nil
+}
@@ -0,0 +1,203 @@
+package bank
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func accountInfo(t *testing.T, b *Bank, id int) AccountInfo {
+	t.Helper()
+	info, err := b.Account(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestHolds(t *testing.T) {
+	for _, engine := range Engines {
+		t.Run(string(engine), func(t *testing.T) {
+			b := newTestBank(t, Config{Engine: engine})
+			defer b.Close()
+			a1, _ := b.OpenAccount(100)
+			a2, _ := b.OpenAccount(100)
+
+			h, err := b.Hold(a1, 30, "card")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The held money is still in the balance and the total.
+			if info := accountInfo(t, b, a1); info.Balance != 100 || info.Held != 30 || info.Available != 70 {
+				t.Errorf("after the hold: %+v", info)
+			}
+			snap := b.Snapshot()
+			if err := snap.Validate(); err != nil || snap.Total != 200 || snap.TotalHeld() != 30 {
+				t.Errorf("after the hold: total %d, held %d, %v", snap.Total, snap.TotalHeld(), err)
+			}
+			if _, err := b.Transfer(context.Background(), a1, a2, 80); !errors.Is(err, ErrInsufficientFunds) {
+				t.Errorf("spending held funds: %v", err)
+			}
+			if _, err := b.Hold(a1, 71, ""); !errors.Is(err, ErrInsufficientFunds) {
+				t.Errorf("holding more than available: %v", err)
+			}
+
+			// Capturing part of the hold moves it and releases the rest.
+			if res, err := b.Capture(h.ID, a2, 20); !res.Committed() || err != nil {
+				t.Fatalf("capture: %v, %v", res.Status, err)
+			}
+			if info := accountInfo(t, b, a1); info.Balance != 80 || info.Held != 0 || info.Available != 80 {
+				t.Errorf("after the capture: %+v", info)
+			}
+			if got, _ := b.Balance(a2); got != 120 {
+				t.Errorf("captured into a balance of %d, want 120", got)
+			}
+			if _, err := b.Capture(h.ID, a2, 5); !errors.Is(err, ErrUnknownHold) {
+				t.Errorf("second capture: %v", err)
+			}
+
+			h, _ = b.Hold(a1, 50, "")
+			if len(b.Holds()) != 1 {
+				t.Errorf("open holds %+v", b.Holds())
+			}
+			if _, err := b.Capture(h.ID, a2, 51); !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("capturing more than held: %v", err)
+			}
+			if err := b.Release(h.ID); err != nil {
+				t.Fatal(err)
+			}
+			if info := accountInfo(t, b, a1); info.Balance != 80 || info.Held != 0 || info.Available != 80 {
+				t.Errorf("after the release: %+v", info)
+			}
+			if err := b.Release(h.ID); !errors.Is(err, ErrUnknownHold) {
+				t.Errorf("second release: %v", err)
+			}
+			if snap := b.Snapshot(); snap.Validate() != nil || snap.Total != 200 {
+				t.Errorf("total %d, %v", snap.Total, snap.Validate())
+			}
+		})
+	}
+}
+
+func TestOverdraftLimit(t *testing.T) {
+	for _, engine := range Engines {
+		t.Run(string(engine), func(t *testing.T) {
+			b := newTestBank(t, Config{Engine: engine})
+			defer b.Close()
+			a1, _ := b.OpenAccount(0)
+			a2, _ := b.OpenAccount(0)
+			if _, err := b.Transfer(context.Background(), a1, a2, 1); !errors.Is(err, ErrInsufficientFunds) {
+				t.Errorf("without a limit: %v", err)
+			}
+			if err := b.SetOverdraftLimit(a1, 50); err != nil {
+				t.Fatal(err)
+			}
+			transfer(t, b, a1, a2, 50)
+			if _, err := b.Transfer(context.Background(), a1, a2, 1); !errors.Is(err, ErrInsufficientFunds) {
+				t.Errorf("past the limit: %v", err)
+			}
+			if _, err := b.TransferMulti(context.Background(), []Leg{{a1, -1}, {a2, 1}}); !errors.Is(err, ErrInsufficientFunds) {
+				t.Errorf("multi-leg past the limit: %v", err)
+			}
+			if err := b.SetOverdraftLimit(a1, 10); !errors.Is(err, ErrInsufficientFunds) {
+				t.Errorf("lowering the limit below the overdraft: %v", err)
+			}
+			if info := accountInfo(t, b, a1); info.Balance != -50 || info.Limit != 50 || info.Available != 0 {
+				t.Errorf("overdrawn account: %+v", info)
+			}
+			if snap := b.Snapshot(); snap.Validate() != nil || snap.Total != 0 {
+				t.Errorf("total %d, %v", snap.Total, snap.Validate())
+			}
+		})
+	}
+}
+
+// waitScheduled waits until the scheduled transfer id is no longer pending.
+func waitScheduled(t *testing.T, b *Bank, id uint64) Scheduled {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		sched, err := b.ScheduledTransfer(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sched.Status != StatusPending {
+			return sched
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scheduled transfer %d never ran", id)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestScheduledTransfer(t *testing.T) {
+	b := newTestBank(t, Config{})
+	defer b.Close()
+	a1, _ := b.OpenAccount(100)
+	a2, _ := b.OpenAccount(0)
+
+	sched, err := b.Schedule(time.Now().Add(20*time.Millisecond), a1, a2, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later, _ := b.Schedule(time.Now().Add(time.Hour), a1, a2, 5)
+	if done := waitScheduled(t, b, sched.ID); done.Status != StatusCommitted || done.TxID == 0 {
+		t.Fatalf("ran with %+v", done)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got, _ := b.Balance(a2); got != 30 {
+		t.Errorf("balance %d, want a single run of 30", got)
+	}
+
+	if err := b.CancelScheduled(later.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.CancelScheduled(sched.ID); !errors.Is(err, ErrNotScheduled) {
+		t.Errorf("cancelling a transfer that ran: %v", err)
+	}
+	if got, _ := b.ScheduledTransfer(later.ID); got.Status != StatusCancelled {
+		t.Errorf("cancelled transfer is %v", got.Status)
+	}
+}
+
+func TestScheduledTransferRecovered(t *testing.T) {
+	cfg := Config{LogPath: filepath.Join(t.TempDir(), "wal")}
+	b := newTestBank(t, cfg)
+	a1, _ := b.OpenAccount(100)
+	a2, _ := b.OpenAccount(0)
+	h, _ := b.Hold(a1, 10, "")
+	sched, err := b.Schedule(time.Now().Add(100*time.Millisecond), a1, a2, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, _ := b.Schedule(time.Now().Add(100*time.Millisecond), a1, a2, 1)
+	b.CancelScheduled(cancelled.ID)
+	// The bank goes down before the transfer is due.
+	b.Close()
+
+	b = newTestBank(t, cfg)
+	if pending := b.Recovered().Scheduled; len(pending) != 1 || pending[0].ID != sched.ID {
+		t.Fatalf("recovered schedule %+v", pending)
+	}
+	if info := accountInfo(t, b, a1); info.Held != 10 || len(b.Holds()) != 1 || b.Holds()[0].ID != h.ID {
+		t.Errorf("recovered hold: %+v, %+v", info, b.Holds())
+	}
+	if done := waitScheduled(t, b, sched.ID); done.Status != StatusCommitted {
+		t.Fatalf("recovered transfer ran with %v", done.Status)
+	}
+	b.Close()
+
+	// Having run once, it does not run again on the next start.
+	b = newTestBank(t, cfg)
+	defer b.Close()
+	if pending := b.Recovered().Scheduled; len(pending) != 0 {
+		t.Errorf("still scheduled after it ran: %+v", pending)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got, _ := b.Balance(a2); got != 30 {
+		t.Errorf("balance %d, want a single run of 30", got)
+	}
+}
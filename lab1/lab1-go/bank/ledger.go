@@ -0,0 +1,203 @@
+package bank
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Commit describes a committed transfer. Seq numbers are gap-free and
+// ordered consistently with the account locks: replaying commits by Seq
+// reproduces every account's history.
+type Commit struct {
+	Seq  uint64 `json:"seq"`
+	TxID uint64 `json:"tx"`
+	Legs []Leg  `json:"legs"`
+	// External commits are deposits and withdrawals; their legs do not net
+	// to zero.
+	External bool   `json:"external,omitempty"`
+	Ref      string `json:"ref,omitempty"`
+}
+
+// Observer is told about every opened account and every committed transfer.
+// Committed runs while the accounts involved are locked, so it must be fast.
+type Observer interface {
+	Opened(id int, currency string, balance int)
+	Committed(c Commit)
+}
+
+// ledger applies every balance change of a Bank. Each change runs under a
+// read lock of cut, so a snapshot taking the write lock sees the accounts
+// between two whole transfers: money is never observed half way between a
+// debit and its credit.
+type ledger struct {
+	cut sync.RWMutex
+	log *Log
+	// deposited is the money brought in by opening accounts, deposits and
+	// withdrawals per currency; at every cut it equals the sum of the
+	// balances in that currency. Entries are only added under the cut write
+	// lock.
+	deposited map[string]*atomic.Int64
+
+	observer Observer
+	seq      atomic.Uint64
+	metrics  *bankMetrics
+
+	holdsMu sync.Mutex
+	holds   map[uint64]Hold
+}
+
+// lockPair locks two accounts in ID order so concurrent transfers between
+// the same accounts cannot deadlock.
+func lockPair(a, b *BankAccount) {
+	if a.ID > b.ID {
+		a, b = b, a
+	}
+	a.lockTimed()
+	b.lockTimed()
+}
+
+func unlockPair(a, b *BankAccount) {
+	a.mu.Unlock()
+	b.mu.Unlock()
+}
+
+// transfer locks both accounts and applies the transfer atomically with
+// respect to snapshots.
+func (l *ledger) transfer(tran Transaction) Status {
+	start := time.Now()
+	defer l.metrics.Apply.ObserveSince(start)
+	l.cut.RLock()
+	defer l.cut.RUnlock()
+	lockPair(tran.from, tran.to)
+	defer unlockPair(tran.from, tran.to)
+	l.metrics.LockWait.ObserveSince(start)
+	return l.apply(tran)
+}
+
+// apply re-checks the funds, logs the commit and moves the money. The caller
+// holds the cut read lock and both account locks.
+func (l *ledger) apply(tran Transaction) Status {
+	if tran.from.available() < tran.Amount {
+		tran.record(RecordAbort)
+		return StatusInsufficientFunds
+	}
+	if tran.record(RecordCommit) != nil {
+		return StatusFailed
+	}
+	tran.from.Balance -= tran.Amount
+	tran.to.Balance += tran.Amount
+	tran.from.version++
+	tran.to.version++
+	tran.from.metrics.transfers.Add(1)
+	tran.to.metrics.transfers.Add(1)
+	if l.observer != nil {
+		l.observer.Committed(Commit{Seq: l.seq.Add(1), TxID: tran.ID, Legs: []Leg{
+			{Account: tran.From, Amount: -tran.Amount},
+			{Account: tran.To, Amount: tran.Amount},
+		}})
+	}
+	return StatusCommitted
+}
+
+func (l *ledger) open(acc *BankAccount) {
+	l.cut.Lock()
+	defer l.cut.Unlock()
+	if l.deposited[acc.Currency] == nil {
+		l.deposited[acc.Currency] = new(atomic.Int64)
+	}
+	l.deposited[acc.Currency].Add(int64(acc.Balance))
+	if l.observer != nil {
+		l.observer.Opened(acc.ID, acc.Currency, acc.Balance)
+	}
+}
+
+// Snapshot is a consistent cut of all account balances. Held funds are part
+// of the balances and of the totals. Total and Expected add up every
+// currency and only mean something for a single-currency bank.
+type Snapshot struct {
+	Balances   map[int]int
+	Held       map[int]int
+	Limits     map[int]int
+	Currencies map[int]string
+	// Totals is the sum of the balances per currency.
+	Totals map[string]int
+	Total  int
+	// ExpectedTotals are the totals the accounts must hold at this cut: their
+	// opening balances plus deposits minus withdrawals, per currency.
+	ExpectedTotals map[string]int
+	Expected       int
+	Taken          time.Time
+}
+
+func (s Snapshot) Consistent() bool {
+	return s.Validate() == nil
+}
+
+// Validate checks the invariants every cut must satisfy: the money of every
+// currency is all there, no account is overdrawn past its limit, which is what a partially
+// applied multi-leg transfer would leave behind, and no hold reserves more
+// than the account has.
+func (s Snapshot) Validate() error {
+	currencies := make([]string, 0, len(s.ExpectedTotals))
+	for currency := range s.ExpectedTotals {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	for _, currency := range currencies {
+		if s.Totals[currency] != s.ExpectedTotals[currency] {
+			return fmt.Errorf("%s total %d, expected %d", currency, s.Totals[currency], s.ExpectedTotals[currency])
+		}
+	}
+	for id, balance := range s.Balances {
+		if balance < -s.Limits[id] {
+			return fmt.Errorf("account %d overdrawn: %d", id, balance)
+		}
+		if held := s.Held[id]; held < 0 || held > balance+s.Limits[id] {
+			return fmt.Errorf("account %d holds %d of %d", id, held, balance)
+		}
+	}
+	return nil
+}
+
+// TotalHeld is the money reserved by holds at this cut.
+func (s Snapshot) TotalHeld() int {
+	total := 0
+	for _, held := range s.Held {
+		total += held
+	}
+	return total
+}
+
+func (l *ledger) snapshot(accounts []*BankAccount) Snapshot {
+	l.cut.Lock()
+	defer l.cut.Unlock()
+	snap := Snapshot{
+		Balances:       make(map[int]int, len(accounts)),
+		Held:           make(map[int]int),
+		Limits:         make(map[int]int),
+		Currencies:     make(map[int]string, len(accounts)),
+		Totals:         make(map[string]int),
+		ExpectedTotals: make(map[string]int, len(l.deposited)),
+		Taken:          time.Now(),
+	}
+	for currency, deposited := range l.deposited {
+		snap.ExpectedTotals[currency] = int(deposited.Load())
+		snap.Expected += int(deposited.Load())
+	}
+	for _, acc := range accounts {
+		snap.Balances[acc.ID] = acc.Balance
+		snap.Currencies[acc.ID] = acc.Currency
+		snap.Totals[acc.Currency] += acc.Balance
+		snap.Total += acc.Balance
+		if acc.held != 0 {
+			snap.Held[acc.ID] = acc.held
+		}
+		if acc.limit != 0 {
+			snap.Limits[acc.ID] = acc.limit
+		}
+	}
+	return snap
+}
@@ -0,0 +1,130 @@
+package bank
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// lockEngine runs every transfer on the caller's goroutine, locking both
+// accounts in ID order.
+type lockEngine struct {
+	ledger *ledger
+}
+
+func newLockEngine(ledger *ledger) *lockEngine {
+	return &lockEngine{ledger: ledger}
+}
+
+func (e *lockEngine) open(acc *BankAccount) {}
+
+func (e *lockEngine) transfer(ctx context.Context, id uint64, key string, from, to *BankAccount, amount int) (Result, error) {
+	res := Result{ID: id, From: from.ID, To: to.ID, Amount: amount}
+	if err := ctx.Err(); err != nil {
+		res.Status = StatusCancelled
+		return res, err
+	}
+	tran := newDirectTransaction(id, from, to, amount, e.ledger)
+	tran.Key = key
+	if tran.record(RecordPrepare) != nil {
+		res.Status = StatusFailed
+		return res, nil
+	}
+	res.Status = e.ledger.transfer(tran)
+	return res, nil
+}
+
+func (e *lockEngine) close() {}
+
+// optimisticEngine reads both accounts without holding their locks and only
+// commits if neither version changed in the meantime. It never waits for an
+// account lock: a busy account counts as a conflict and the transfer retries.
+type optimisticEngine struct {
+	ledger *ledger
+}
+
+func newOptimisticEngine(ledger *ledger) *optimisticEngine {
+	return &optimisticEngine{ledger: ledger}
+}
+
+func (e *optimisticEngine) open(acc *BankAccount) {}
+
+func (e *optimisticEngine) transfer(ctx context.Context, id uint64, key string, from, to *BankAccount, amount int) (Result, error) {
+	res := Result{ID: id, From: from.ID, To: to.ID, Amount: amount}
+	tran := newDirectTransaction(id, from, to, amount, e.ledger)
+	tran.Key = key
+	prepared := false
+	backoff := newBackoff()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			if prepared {
+				tran.record(RecordAbort)
+			}
+			res.Status = StatusCancelled
+			return res, err
+		}
+
+		fromAvailable, fromVersion := from.read()
+		_, toVersion := to.read()
+		if fromAvailable < amount {
+			if prepared {
+				tran.record(RecordAbort)
+			}
+			res.Status = StatusInsufficientFunds
+			return res, nil
+		}
+		if !prepared {
+			if tran.record(RecordPrepare) != nil {
+				res.Status = StatusFailed
+				return res, nil
+			}
+			prepared = true
+		}
+
+		if status, ok := e.tryCommit(tran, fromVersion, toVersion); ok {
+			res.Status = status
+			return res, nil
+		}
+		e.ledger.metrics.retries.Add(1)
+		backoff.wait()
+	}
+}
+
+func (e *optimisticEngine) tryCommit(tran Transaction, fromVersion, toVersion uint64) (Status, bool) {
+	defer e.ledger.metrics.Apply.ObserveSince(time.Now())
+	e.ledger.cut.RLock()
+	defer e.ledger.cut.RUnlock()
+	if !tran.from.mu.TryLock() {
+		return StatusPending, false
+	}
+	defer tran.from.mu.Unlock()
+	if !tran.to.mu.TryLock() {
+		return StatusPending, false
+	}
+	defer tran.to.mu.Unlock()
+
+	if tran.from.version != fromVersion || tran.to.version != toVersion {
+		return StatusPending, false
+	}
+	return e.ledger.apply(tran), true
+}
+
+func (e *optimisticEngine) close() {}
+
+func newDirectTransaction(id uint64, from, to *BankAccount, amount int, ledger *ledger) Transaction {
+	return Transaction{ID: id, From: from.ID, To: to.ID, Amount: amount, from: from, to: to, ledger: ledger}
+}
+
+// backoff is a randomized exponential delay between optimistic retries.
+type backoff time.Duration
+
+func newBackoff() *backoff {
+	b := backoff(time.Microsecond)
+	return &b
+}
+
+func (b *backoff) wait() {
+	time.Sleep(time.Duration(rand.Int63n(int64(*b))))
+	*b = min(2**b, backoff(time.Millisecond))
+}
@@ -0,0 +1,140 @@
+package bank
+
+import (
+	"io"
+	"lab1-go/metrics"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Latencies splits the time of a transfer into its phases. QueueWait and
+// Handshake are only measured by the channel engine.
+type Latencies struct {
+	// QueueWait runs from submission until the source worker picks the
+	// transfer up (for multi-leg transfers: until every worker did).
+	QueueWait *metrics.Histogram
+	// Handshake runs from the source worker starting the transfer until the
+	// destination worker reached it.
+	Handshake *metrics.Histogram
+	// Apply is the time spent in the ledger, lock waits included.
+	Apply *metrics.Histogram
+	// LockWait is the time spent acquiring the snapshot and account locks.
+	LockWait *metrics.Histogram
+}
+
+type bankMetrics struct {
+	Latencies
+	retries atomic.Int64
+}
+
+func newBankMetrics() *bankMetrics {
+	return &bankMetrics{Latencies: Latencies{
+		QueueWait: metrics.NewHistogram(metrics.DefaultBuckets),
+		Handshake: metrics.NewHistogram(metrics.DefaultBuckets),
+		Apply:     metrics.NewHistogram(metrics.DefaultBuckets),
+		LockWait:  metrics.NewHistogram(metrics.DefaultBuckets),
+	}}
+}
+
+type accountMetrics struct {
+	transfers     atomic.Int64
+	lockWait      atomic.Int64
+	maxQueueDepth atomic.Int64
+}
+
+func (m *accountMetrics) observeQueueDepth(depth int) {
+	for {
+		current := m.maxQueueDepth.Load()
+		if int64(depth) <= current || m.maxQueueDepth.CompareAndSwap(current, int64(depth)) {
+			return
+		}
+	}
+}
+
+// lockTimed locks the account and charges the wait to it.
+func (account *BankAccount) lockTimed() {
+	if account.mu.TryLock() {
+		return
+	}
+	start := time.Now()
+	account.mu.Lock()
+	account.metrics.lockWait.Add(int64(time.Since(start)))
+}
+
+// AccountMetrics shows how contended a single account is.
+type AccountMetrics struct {
+	ID            int
+	QueueDepth    int
+	MaxQueueDepth int
+	LockWait      time.Duration
+	Transfers     int64
+}
+
+func (b *Bank) Latencies() Latencies {
+	return b.ledger.metrics.Latencies
+}
+
+// OptimisticRetries counts the commit attempts the optimistic engine had to
+// repeat because of a conflict.
+func (b *Bank) OptimisticRetries() int64 {
+	return b.ledger.metrics.retries.Load()
+}
+
+func (b *Bank) AccountMetrics() []AccountMetrics {
+	ids := b.Accounts()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	result := make([]AccountMetrics, 0, len(ids))
+	for _, id := range ids {
+		acc := b.accounts[id]
+		result = append(result, AccountMetrics{
+			ID:            id,
+			QueueDepth:    len(acc.Ch),
+			MaxQueueDepth: int(acc.metrics.maxQueueDepth.Load()),
+			LockWait:      time.Duration(acc.metrics.lockWait.Load()),
+			Transfers:     acc.metrics.transfers.Load(),
+		})
+	}
+	return result
+}
+
+// WriteMetrics writes every bank metric in the Prometheus text format.
+func (b *Bank) WriteMetrics(w io.Writer) {
+	e := metrics.NewExposition(w)
+	stats := b.Stats()
+	for _, s := range []struct {
+		status Status
+		value  int64
+	}{
+		{StatusCommitted, stats.Committed},
+		{StatusInsufficientFunds, stats.InsufficientFunds},
+		{StatusUnknownAccount, stats.UnknownAccount},
+		{StatusCancelled, stats.Cancelled},
+		{StatusInvalid, stats.Invalid},
+		{StatusFailed, stats.Failed},
+	} {
+		e.Counter("bank_transfers_total", "Transfers by final status.", float64(s.value), "status", s.status.String())
+	}
+	e.Counter("bank_optimistic_retries_total", "Commit attempts repeated by the optimistic engine.", float64(b.OptimisticRetries()))
+
+	lat := b.Latencies()
+	e.Histogram("bank_transfer_phase_seconds", "Time spent in each phase of a transfer.", lat.QueueWait, "phase", "queue_wait")
+	e.Histogram("bank_transfer_phase_seconds", "Time spent in each phase of a transfer.", lat.Handshake, "phase", "handshake")
+	e.Histogram("bank_transfer_phase_seconds", "Time spent in each phase of a transfer.", lat.Apply, "phase", "apply")
+	e.Histogram("bank_lock_wait_seconds", "Time spent acquiring ledger locks per transfer.", lat.LockWait)
+
+	accounts := b.AccountMetrics()
+	for _, acc := range accounts {
+		e.Gauge("bank_account_queue_depth", "Transfers waiting in the account channel.", float64(acc.QueueDepth), "account", strconv.Itoa(acc.ID))
+	}
+	for _, acc := range accounts {
+		e.Gauge("bank_account_max_queue_depth", "Highest account channel depth seen.", float64(acc.MaxQueueDepth), "account", strconv.Itoa(acc.ID))
+	}
+	for _, acc := range accounts {
+		e.Counter("bank_account_lock_wait_seconds_total", "Time spent waiting for the account lock.", acc.LockWait.Seconds(), "account", strconv.Itoa(acc.ID))
+	}
+	for _, acc := range accounts {
+		e.Counter("bank_account_transfers_total", "Committed transfers touching the account.", float64(acc.Transfers), "account", strconv.Itoa(acc.ID))
+	}
+}
@@ -0,0 +1,292 @@
+package bank
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Leg is one side of a multi-leg transfer: a negative amount debits the
+// account, a positive one credits it.
+type Leg struct {
+	Account int `json:"account"`
+	Amount  int `json:"amount"`
+}
+
+// MultiResult is the outcome of a multi-leg transfer; either every leg was
+// applied or none was.
+type MultiResult struct {
+	ID     uint64
+	Legs   []Leg
+	Status Status
+}
+
+func (r MultiResult) Committed() bool {
+	return r.Status == StatusCommitted
+}
+
+// ValidateLegs checks that a multi-leg transfer moves money without creating
+// or destroying any: the legs net to zero, touch every account at most once
+// and none of them is empty.
+func ValidateLegs(legs []Leg) error {
+	if len(legs) < 2 {
+		return fmt.Errorf("%w: a transfer needs at least two legs", ErrInvalidAmount)
+	}
+	seen := make(map[int]bool, len(legs))
+	net := 0
+	for _, leg := range legs {
+		if leg.Amount == 0 {
+			return fmt.Errorf("%w: empty leg for account %d", ErrInvalidAmount, leg.Account)
+		}
+		if seen[leg.Account] {
+			return fmt.Errorf("%w: account %d appears twice", ErrInvalidAmount, leg.Account)
+		}
+		seen[leg.Account] = true
+		net += leg.Amount
+	}
+	if net != 0 {
+		return fmt.Errorf("%w: legs net to %d", ErrInvalidAmount, net)
+	}
+	return nil
+}
+
+// TransferMulti applies all legs atomically: if any debited account lacks the
+// funds nothing is applied.
+func (b *Bank) TransferMulti(ctx context.Context, legs []Leg) (MultiResult, error) {
+	return b.TransferMultiWithKey(ctx, "", legs)
+}
+
+// TransferMultiWithKey is TransferMulti with an idempotency key, kept as by
+// TransferWithKey.
+func (b *Bank) TransferMultiWithKey(ctx context.Context, key string, legs []Leg) (MultiResult, error) {
+	res, err := b.transferMulti(ctx, key, legs)
+	b.stats.record(res.Status)
+	return res, err
+}
+
+func (b *Bank) transferMulti(ctx context.Context, key string, legs []Leg) (MultiResult, error) {
+	legs = append([]Leg(nil), legs...)
+	sort.Slice(legs, func(i, j int) bool { return legs[i].Account < legs[j].Account })
+	if err := ValidateLegs(legs); err != nil {
+		return MultiResult{Legs: legs, Status: StatusInvalid}, err
+	}
+	return b.submitLegs(ctx, Transaction{Legs: legs, Key: key})
+}
+
+// submitLegs runs tran, whose legs are sorted by account, through the
+// engine's multi-leg path.
+func (b *Bank) submitLegs(ctx context.Context, tran Transaction) (MultiResult, error) {
+	legs := tran.Legs
+	res := MultiResult{Legs: legs}
+	if err := ctx.Err(); err != nil {
+		res.Status = StatusCancelled
+		return res, err
+	}
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		res.Status = StatusCancelled
+		return res, ErrClosed
+	}
+	accounts := make([]*BankAccount, len(legs))
+	for i, leg := range legs {
+		acc, ok := b.accounts[leg.Account]
+		if !ok {
+			b.mu.RUnlock()
+			res.Status = StatusUnknownAccount
+			return res, ErrUnknownAccount
+		}
+		accounts[i] = acc
+	}
+	if !tran.external && !balancedPerCurrency(legs, accounts) {
+		b.mu.RUnlock()
+		res.Status = StatusInvalid
+		return res, ErrCurrencyMismatch
+	}
+	b.inflight.Add(1)
+	b.mu.RUnlock()
+	defer b.inflight.Done()
+
+	ctx, cancel := b.transferContext(ctx)
+	defer cancel()
+	res.ID = b.nextTxID.Add(1) - 1
+	tran.ID = res.ID
+	tran.accounts = accounts
+	tran.ctx = ctx
+	tran.ledger = &b.ledger
+	res.Status = b.engine.transferMulti(tran)
+	if res.Status == StatusCancelled {
+		return res, ctx.Err()
+	}
+	return res, res.err()
+}
+
+func (r MultiResult) err() error {
+	return Result{Status: r.Status}.err()
+}
+
+// lockAll locks accounts that are already sorted by ID.
+func lockAll(accounts []*BankAccount) {
+	for _, acc := range accounts {
+		acc.lockTimed()
+	}
+}
+
+func unlockAll(accounts []*BankAccount) {
+	for _, acc := range accounts {
+		acc.mu.Unlock()
+	}
+}
+
+func (l *ledger) transferMulti(tran Transaction) Status {
+	start := time.Now()
+	defer l.metrics.Apply.ObserveSince(start)
+	l.cut.RLock()
+	defer l.cut.RUnlock()
+	lockAll(tran.accounts)
+	defer unlockAll(tran.accounts)
+	l.metrics.LockWait.ObserveSince(start)
+	return l.applyMulti(tran)
+}
+
+// applyMulti is apply for multi-leg transfers; the caller holds the cut read
+// lock and every account lock.
+func (l *ledger) applyMulti(tran Transaction) Status {
+	for i, leg := range tran.Legs {
+		if leg.Amount < 0 && tran.accounts[i].available()+leg.Amount < 0 {
+			tran.record(RecordAbort)
+			return StatusInsufficientFunds
+		}
+	}
+	if tran.record(RecordCommit) != nil {
+		return StatusFailed
+	}
+	for i, leg := range tran.Legs {
+		tran.accounts[i].Balance += leg.Amount
+		tran.accounts[i].version++
+		tran.accounts[i].metrics.transfers.Add(1)
+		if tran.external {
+			l.deposited[tran.accounts[i].Currency].Add(int64(leg.Amount))
+		}
+	}
+	if l.observer != nil {
+		l.observer.Committed(Commit{Seq: l.seq.Add(1), TxID: tran.ID, Legs: tran.Legs, External: tran.external, Ref: tran.Ref})
+	}
+	return StatusCommitted
+}
+
+// transferMulti queues the transfer on every account involved. Each worker
+// reports on arriveCh and then waits; once all of them are parked the
+// submitter applies the legs and releases them.
+func (e *channelEngine) transferMulti(tran Transaction) Status {
+	tran.arriveCh = make(chan struct{})
+	tran.appliedCh = make(chan struct{})
+	defer close(tran.appliedCh)
+
+	tran.queuedAt = time.Now()
+	e.submitMu.Lock()
+	queued := true
+	for _, acc := range tran.accounts {
+		if !enqueue(tran.ctx, acc.Ch, tran) {
+			queued = false
+			break
+		}
+	}
+	e.submitMu.Unlock()
+	if !queued {
+		return StatusCancelled
+	}
+
+	for range tran.accounts {
+		select {
+		case <-tran.arriveCh:
+		case <-tran.ctx.Done():
+			return StatusCancelled
+		}
+	}
+	e.ledger.metrics.QueueWait.ObserveSince(tran.queuedAt)
+	if tran.record(RecordPrepare) != nil {
+		return StatusFailed
+	}
+	return tran.ledger.transferMulti(tran)
+}
+
+func (account *BankAccount) join(tran Transaction) {
+	select {
+	case tran.arriveCh <- struct{}{}:
+		<-tran.appliedCh
+	case <-tran.ctx.Done():
+	}
+}
+
+func (e *lockEngine) transferMulti(tran Transaction) Status {
+	if tran.ctx.Err() != nil {
+		return StatusCancelled
+	}
+	if tran.record(RecordPrepare) != nil {
+		return StatusFailed
+	}
+	return e.ledger.transferMulti(tran)
+}
+
+func (e *optimisticEngine) transferMulti(tran Transaction) Status {
+	versions := make([]uint64, len(tran.accounts))
+	prepared := false
+	backoff := newBackoff()
+	for {
+		if tran.ctx.Err() != nil {
+			if prepared {
+				tran.record(RecordAbort)
+			}
+			return StatusCancelled
+		}
+
+		funded := true
+		for i, acc := range tran.accounts {
+			var available int
+			available, versions[i] = acc.read()
+			if leg := tran.Legs[i]; leg.Amount < 0 && available+leg.Amount < 0 {
+				funded = false
+			}
+		}
+		if !funded {
+			if prepared {
+				tran.record(RecordAbort)
+			}
+			return StatusInsufficientFunds
+		}
+		if !prepared {
+			if tran.record(RecordPrepare) != nil {
+				return StatusFailed
+			}
+			prepared = true
+		}
+
+		if status, ok := e.tryCommitMulti(tran, versions); ok {
+			return status
+		}
+		e.ledger.metrics.retries.Add(1)
+		backoff.wait()
+	}
+}
+
+func (e *optimisticEngine) tryCommitMulti(tran Transaction, versions []uint64) (Status, bool) {
+	e.ledger.cut.RLock()
+	defer e.ledger.cut.RUnlock()
+	for i, acc := range tran.accounts {
+		if !acc.mu.TryLock() {
+			unlockAll(tran.accounts[:i])
+			return StatusPending, false
+		}
+	}
+	defer unlockAll(tran.accounts)
+
+	for i, acc := range tran.accounts {
+		if acc.version != versions[i] {
+			return StatusPending, false
+		}
+	}
+	return e.ledger.applyMulti(tran), true
+}
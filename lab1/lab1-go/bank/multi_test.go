@@ -0,0 +1,142 @@
+package bank
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestValidateLegs(t *testing.T) {
+	tests := []struct {
+		name string
+		legs []Leg
+		ok   bool
+	}{
+		{"two legs", []Leg{{1, -5}, {2, 5}}, true},
+		{"split", []Leg{{1, -10}, {2, 3}, {3, 7}}, true},
+		{"single leg", []Leg{{1, -5}}, false},
+		{"empty leg", []Leg{{1, -5}, {2, 5}, {3, 0}}, false},
+		{"account twice", []Leg{{1, -5}, {1, 5}}, false},
+		{"does not net to zero", []Leg{{1, -5}, {2, 4}}, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateLegs(tt.legs); (err == nil) != tt.ok {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestTransferMultiAtomic(t *testing.T) {
+	for _, engine := range Engines {
+		t.Run(string(engine), func(t *testing.T) {
+			b := newTestBank(t, Config{Engine: engine})
+			defer b.Close()
+			a1, _ := b.OpenAccount(100)
+			a2, _ := b.OpenAccount(10)
+			a3, _ := b.OpenAccount(0)
+
+			// a2 cannot cover its leg, so a1's funded leg is not applied either.
+			legs := []Leg{{a1, -50}, {a2, -20}, {a3, 70}}
+			if res, err := b.TransferMulti(context.Background(), legs); res.Status != StatusInsufficientFunds || !errors.Is(err, ErrInsufficientFunds) {
+				t.Fatalf("underfunded: %v, %v", res.Status, err)
+			}
+			want := map[int]int{a1: 100, a2: 10, a3: 0}
+			for id, balance := range want {
+				if got, _ := b.Balance(id); got != balance {
+					t.Errorf("account %d: balance %d after a rejected transfer, want %d", id, got, balance)
+				}
+			}
+
+			legs = []Leg{{a1, -50}, {a2, -10}, {a3, 60}}
+			if res, err := b.TransferMulti(context.Background(), legs); !res.Committed() || err != nil {
+				t.Fatalf("funded: %v, %v", res.Status, err)
+			}
+			want = map[int]int{a1: 50, a2: 0, a3: 60}
+			for id, balance := range want {
+				if got, _ := b.Balance(id); got != balance {
+					t.Errorf("account %d: balance %d, want %d", id, got, balance)
+				}
+			}
+
+			if res, err := b.TransferMulti(context.Background(), []Leg{{a1, -5}, {99, 5}}); res.Status != StatusUnknownAccount || err == nil {
+				t.Errorf("unknown account: %v, %v", res.Status, err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if res, err := b.TransferMulti(ctx, []Leg{{a1, -5}, {a3, 5}}); res.Status != StatusCancelled || !errors.Is(err, context.Canceled) {
+				t.Errorf("cancelled: %v, %v", res.Status, err)
+			}
+		})
+	}
+}
+
+// TestTransferMultiConcurrent mixes multi-leg and single-leg transfers over
+// the same accounts and checks every cut along the way.
+func TestTransferMultiConcurrent(t *testing.T) {
+	for _, engine := range Engines {
+		t.Run(string(engine), func(t *testing.T) {
+			b := newTestBank(t, Config{Engine: engine})
+			defer b.Close()
+			ids := make([]int, 8)
+			for i := range ids {
+				ids[i], _ = b.OpenAccount(100)
+			}
+
+			done := make(chan struct{})
+			var checks sync.WaitGroup
+			checks.Add(1)
+			go func() {
+				defer checks.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					if snap := b.Snapshot(); snap.Validate() != nil || snap.Total != 800 {
+						t.Errorf("cut with total %d: %v", snap.Total, snap.Validate())
+						return
+					}
+				}
+			}()
+
+			var wg sync.WaitGroup
+			for c := range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					rng := rand.New(rand.NewSource(int64(c)))
+					for range 200 {
+						perm := rng.Perm(len(ids))
+						var err error
+						if c%2 == 0 {
+							amount := 1 + rng.Intn(40)
+							_, err = b.TransferMulti(context.Background(), []Leg{
+								{ids[perm[0]], -2 * amount},
+								{ids[perm[1]], amount},
+								{ids[perm[2]], amount},
+							})
+						} else {
+							_, err = b.Transfer(context.Background(), ids[perm[0]], ids[perm[1]], 1+rng.Intn(60))
+						}
+						if err != nil && !errors.Is(err, ErrInsufficientFunds) {
+							t.Error(err)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			close(done)
+			checks.Wait()
+
+			if snap := b.Snapshot(); snap.Validate() != nil || snap.Total != 800 {
+				t.Errorf("final total %d: %v", snap.Total, snap.Validate())
+			}
+			if stats := b.Stats(); stats.Committed == 0 || stats.Committed+stats.InsufficientFunds != 8*200 {
+				t.Errorf("stats %+v", stats)
+			}
+		})
+	}
+}
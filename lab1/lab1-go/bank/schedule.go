@@ -0,0 +1,240 @@
+package bank
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrNotScheduled = errors.New("no pending scheduled transfer")
+
+// Scheduled is a transfer that runs at a future time.
+type Scheduled struct {
+	ID     uint64    `json:"id"`
+	At     time.Time `json:"at"`
+	From   int       `json:"from"`
+	To     int       `json:"to"`
+	Amount int       `json:"amount"`
+	// Status stays StatusPending until the transfer ran or was cancelled.
+	Status Status `json:"status"`
+	// TxID is the transfer that ran it.
+	TxID uint64 `json:"tx,omitempty"`
+}
+
+// scheduleRef is the reference of the transfer running a scheduled one; it
+// tells recovery that the schedule already ran.
+func scheduleRef(id uint64) string {
+	return "schedule-" + strconv.FormatUint(id, 10)
+}
+
+// scheduler keeps the pending transfers in a heap ordered by due time and
+// arms a single timer for the earliest one.
+type scheduler struct {
+	mu      sync.Mutex
+	pending scheduleHeap
+	all     map[uint64]*Scheduled
+	timer   *time.Timer
+	stopped bool
+	run     func(s Scheduled)
+	wg      sync.WaitGroup
+}
+
+func newScheduler(run func(s Scheduled)) *scheduler {
+	return &scheduler{all: make(map[uint64]*Scheduled), run: run}
+}
+
+func (s *scheduler) add(sched Scheduled) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := &sched
+	s.all[sched.ID] = entry
+	heap.Push(&s.pending, entry)
+	s.arm()
+}
+
+// arm resets the timer to the earliest pending transfer. The caller holds mu.
+func (s *scheduler) arm() {
+	if s.stopped || len(s.pending) == 0 {
+		return
+	}
+	wait := time.Until(s.pending[0].At)
+	if s.timer == nil {
+		s.timer = time.AfterFunc(wait, s.fire)
+	} else {
+		s.timer.Reset(wait)
+	}
+}
+
+// fire starts every transfer that is due.
+func (s *scheduler) fire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	now := time.Now()
+	for len(s.pending) > 0 && !s.pending[0].At.After(now) {
+		entry := heap.Pop(&s.pending).(*Scheduled)
+		s.wg.Add(1)
+		go func(sched Scheduled) {
+			defer s.wg.Done()
+			s.run(sched)
+		}(*entry)
+	}
+	s.arm()
+}
+
+// cancel removes a pending transfer; it fails once the transfer started.
+func (s *scheduler) cancel(id uint64, logged func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.all[id]
+	if !ok || entry.Status != StatusPending {
+		return ErrNotScheduled
+	}
+	i := s.pending.index(entry)
+	if i < 0 {
+		return ErrNotScheduled
+	}
+	if err := logged(); err != nil {
+		return err
+	}
+	heap.Remove(&s.pending, i)
+	entry.Status = StatusCancelled
+	return nil
+}
+
+func (s *scheduler) finish(id, txID uint64, status Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.all[id].Status = status
+	s.all[id].TxID = txID
+}
+
+func (s *scheduler) get(id uint64) (Scheduled, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.all[id]
+	if !ok {
+		return Scheduled{}, false
+	}
+	return *entry, true
+}
+
+func (s *scheduler) list() []Scheduled {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Scheduled, 0, len(s.all))
+	for _, entry := range s.all {
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// stop disarms the timer; transfers not yet started stay pending.
+func (s *scheduler) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.mu.Unlock()
+}
+
+type scheduleHeap []*Scheduled
+
+func (h scheduleHeap) Len() int { return len(h) }
+func (h scheduleHeap) Less(i, j int) bool {
+	if !h[i].At.Equal(h[j].At) {
+		return h[i].At.Before(h[j].At)
+	}
+	return h[i].ID < h[j].ID
+}
+func (h scheduleHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *scheduleHeap) Push(x any)   { *h = append(*h, x.(*Scheduled)) }
+func (h *scheduleHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+func (h scheduleHeap) index(entry *Scheduled) int {
+	for i, e := range h {
+		if e == entry {
+			return i
+		}
+	}
+	return -1
+}
+
+// Schedule runs a transfer at the given time; a time in the past runs it
+// right away. With a transaction log, transfers still pending at a crash are
+// scheduled again on recovery.
+func (b *Bank) Schedule(at time.Time, from, to, amount int) (Scheduled, error) {
+	if amount <= 0 || from == to {
+		return Scheduled{}, ErrInvalidAmount
+	}
+	accounts, err := b.acquire(from, to)
+	if err != nil {
+		return Scheduled{}, err
+	}
+	defer b.inflight.Done()
+	if accounts[0].Currency != accounts[1].Currency {
+		return Scheduled{}, ErrCurrencyMismatch
+	}
+
+	sched := Scheduled{ID: b.nextTxID.Add(1) - 1, At: at, From: from, To: to, Amount: amount}
+	if b.ledger.log != nil {
+		rec := Record{Type: RecordSchedule, TxID: sched.ID, From: from, To: to, Amount: amount, At: at}
+		if err := b.ledger.log.Append(rec); err != nil {
+			return Scheduled{}, err
+		}
+	}
+	b.scheduler.add(sched)
+	return sched, nil
+}
+
+// CancelScheduled cancels a transfer that has not started yet.
+func (b *Bank) CancelScheduled(id uint64) error {
+	return b.scheduler.cancel(id, func() error {
+		if b.ledger.log == nil {
+			return nil
+		}
+		return b.ledger.log.Append(Record{Type: RecordUnschedule, TxID: id})
+	})
+}
+
+func (b *Bank) ScheduledTransfer(id uint64) (Scheduled, error) {
+	sched, ok := b.scheduler.get(id)
+	if !ok {
+		return Scheduled{}, ErrNotScheduled
+	}
+	return sched, nil
+}
+
+// ScheduledTransfers returns every scheduled transfer ordered by ID.
+func (b *Bank) ScheduledTransfers() []Scheduled {
+	return b.scheduler.list()
+}
+
+// runScheduled executes a due transfer. One cut short by a shutdown stays
+// pending in the log, so recovery runs it again.
+func (b *Bank) runScheduled(sched Scheduled) {
+	legs := []Leg{{Account: sched.From, Amount: -sched.Amount}, {Account: sched.To, Amount: sched.Amount}}
+	sort.Slice(legs, func(i, j int) bool { return legs[i].Account < legs[j].Account })
+	res, err := b.submitLegs(context.Background(), Transaction{Legs: legs, Ref: scheduleRef(sched.ID)})
+	if errors.Is(err, ErrClosed) {
+		return
+	}
+	b.stats.record(res.Status)
+	b.scheduler.finish(sched.ID, res.ID, res.Status)
+	if res.Status != StatusCommitted && res.Status != StatusCancelled && b.ledger.log != nil {
+		b.ledger.log.Append(Record{Type: RecordUnschedule, TxID: sched.ID})
+	}
+}
@@ -0,0 +1,54 @@
+package bank
+
+import "sync/atomic"
+
+// Stats counts the outcomes of every transfer submitted to a Bank.
+type Stats struct {
+	Submitted         int64 `json:"submitted"`
+	Committed         int64 `json:"committed"`
+	InsufficientFunds int64 `json:"insufficient_funds"`
+	UnknownAccount    int64 `json:"unknown_account"`
+	Cancelled         int64 `json:"cancelled"`
+	Invalid           int64 `json:"invalid"`
+	Failed            int64 `json:"failed"`
+}
+
+type stats struct {
+	submitted         atomic.Int64
+	committed         atomic.Int64
+	insufficientFunds atomic.Int64
+	unknownAccount    atomic.Int64
+	cancelled         atomic.Int64
+	invalid           atomic.Int64
+	failed            atomic.Int64
+}
+
+func (s *stats) record(status Status) {
+	s.submitted.Add(1)
+	switch status {
+	case StatusCommitted:
+		s.committed.Add(1)
+	case StatusInsufficientFunds:
+		s.insufficientFunds.Add(1)
+	case StatusUnknownAccount:
+		s.unknownAccount.Add(1)
+	case StatusCancelled:
+		s.cancelled.Add(1)
+	case StatusInvalid:
+		s.invalid.Add(1)
+	case StatusFailed:
+		s.failed.Add(1)
+	}
+}
+
+func (s *stats) snapshot() Stats {
+	return Stats{
+		Submitted:         s.submitted.Load(),
+		Committed:         s.committed.Load(),
+		InsufficientFunds: s.insufficientFunds.Load(),
+		UnknownAccount:    s.unknownAccount.Load(),
+		Cancelled:         s.cancelled.Load(),
+		Invalid:           s.invalid.Load(),
+		Failed:            s.failed.Load(),
+	}
+}
@@ -0,0 +1,132 @@
+package bank
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	tranQueued int32 = iota
+	tranClaimed
+	tranAbandoned
+)
+
+type Transaction struct {
+	ID     uint64
+	From   int
+	To     int
+	Amount int
+	// Legs is set instead of From/To/Amount for multi-leg transfers.
+	Legs []Leg
+	// Ref is the caller's reference of a deposit or withdrawal.
+	Ref string
+	// Key is the caller's idempotency key of a transfer.
+	Key           string
+	external      bool
+	from          *BankAccount
+	to            *BankAccount
+	accounts      []*BankAccount
+	ctx           context.Context
+	queuedAt      time.Time
+	state         *atomic.Int32
+	ledger        *ledger
+	otherTxDoneCh chan bool
+	arriveCh      chan struct{}
+	appliedCh     chan struct{}
+	resultCh      chan Status
+}
+
+// claim is called by the source leg before it starts; once it succeeds the
+// submitter waits for a status on resultCh.
+func (tran Transaction) claim() bool {
+	return tran.state.CompareAndSwap(tranQueued, tranClaimed)
+}
+
+// abandon is called by the submitter when its context ends; it fails if the
+// source leg has already claimed the transfer.
+func (tran Transaction) abandon() bool {
+	return tran.state.CompareAndSwap(tranQueued, tranAbandoned)
+}
+
+func (tran Transaction) record(typ RecordType) error {
+	if tran.ledger.log == nil {
+		return nil
+	}
+	rec := Record{Type: typ, TxID: tran.ID}
+	if typ == RecordPrepare {
+		rec.From, rec.To, rec.Amount, rec.Legs, rec.Ref, rec.Key = tran.From, tran.To, tran.Amount, tran.Legs, tran.Ref, tran.Key
+		if tran.Key != "" {
+			rec.At = time.Now()
+		}
+	}
+	return tran.ledger.log.Append(rec)
+}
+
+type Status int
+
+const (
+	StatusPending Status = iota
+	StatusCommitted
+	StatusInsufficientFunds
+	StatusUnknownAccount
+	StatusCancelled
+	StatusInvalid
+	StatusFailed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPending:
+		return "pending"
+	case StatusCommitted:
+		return "committed"
+	case StatusInsufficientFunds:
+		return "insufficient funds"
+	case StatusUnknownAccount:
+		return "unknown account"
+	case StatusCancelled:
+		return "cancelled"
+	case StatusInvalid:
+		return "invalid"
+	case StatusFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// Result is the outcome of a single submitted transfer.
+type Result struct {
+	ID     uint64
+	From   int
+	To     int
+	Amount int
+	Status Status
+}
+
+func (r Result) Committed() bool {
+	return r.Status == StatusCommitted
+}
+
+func (r Result) err() error {
+	return r.Status.Err()
+}
+
+// Err returns the error Bank methods report along with s.
+func (s Status) Err() error {
+	switch s {
+	case StatusCommitted:
+		return nil
+	case StatusInsufficientFunds:
+		return ErrInsufficientFunds
+	case StatusUnknownAccount:
+		return ErrUnknownAccount
+	case StatusCancelled:
+		return context.Canceled
+	case StatusInvalid:
+		return ErrInvalidAmount
+	case StatusFailed:
+		return ErrLog
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package bank
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrLog = errors.New("transaction log failed")
+
+type RecordType string
+
+const (
+	RecordOpen    RecordType = "open"
+	RecordPrepare RecordType = "prepare"
+	RecordCommit  RecordType = "commit"
+	RecordAbort   RecordType = "abort"
+
+	RecordLimit      RecordType = "limit"
+	RecordHold       RecordType = "hold"
+	RecordCapture    RecordType = "capture"
+	RecordRelease    RecordType = "release"
+	RecordSchedule   RecordType = "schedule"
+	RecordUnschedule RecordType = "unschedule"
+)
+
+// Record is one line of the transaction log. Open records carry the initial
+// balance of an account, prepare records the transfer itself and commit/abort
+// records only the transfer ID. Limit, hold, capture and release records are
+// applied as they are read; schedule records a future transfer that is still
+// due unless an unschedule record or a commit with its reference follows.
+// The prepare record of a transfer with an idempotency key has the time it
+// was submitted in At.
+type Record struct {
+	Type    RecordType `json:"type"`
+	TxID    uint64     `json:"tx,omitempty"`
+	Account int        `json:"account,omitempty"`
+	Balance int        `json:"balance,omitempty"`
+	From    int        `json:"from,omitempty"`
+	To      int        `json:"to,omitempty"`
+	Amount  int        `json:"amount,omitempty"`
+	Legs    []Leg      `json:"legs,omitempty"`
+	Ref     string     `json:"ref,omitempty"`
+	Key     string     `json:"key,omitempty"`
+	Limit   int        `json:"limit,omitempty"`
+	Hold    uint64     `json:"hold,omitempty"`
+	At      time.Time  `json:"at,omitzero"`
+	// Currency and House describe an opened account; House marks the FX
+	// house account of its currency.
+	Currency string `json:"currency,omitempty"`
+	House    bool   `json:"house,omitempty"`
+}
+
+// Log is an append-only, file-backed transaction log. After the first write
+// error the log refuses every further append.
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+	sync bool
+	err  error
+}
+
+func OpenLog(path string, sync bool) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{file: file, sync: sync}, nil
+}
+
+func (l *Log) Append(rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	if _, err := l.file.Write(line); err != nil {
+		l.err = fmt.Errorf("%w: %v", ErrLog, err)
+		return l.err
+	}
+	if l.sync {
+		if err := l.file.Sync(); err != nil {
+			l.err = fmt.Errorf("%w: %v", ErrLog, err)
+			return l.err
+		}
+	}
+	return nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err == nil {
+		l.err = ErrClosed
+	}
+	return l.file.Close()
+}
+
+// ReadLog returns every complete record of the log at path and the length
+// in bytes of those records. A torn last line left by a crash is ignored;
+// it lies beyond that length.
+func ReadLog(path string) ([]Record, int64, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var records []Record
+	var size int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return records, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, 0, fmt.Errorf("corrupt log record %d: %v", len(records)+1, err)
+		}
+		records = append(records, rec)
+		size += int64(len(line))
+	}
+}
+
+// truncateLog cuts the log at path down to size bytes and syncs it, so a
+// torn last line does not get the next record appended to it.
+func truncateLog(path string, size int64) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == size {
+		return nil
+	}
+	if err := file.Truncate(size); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// KeyedTransfer is a committed transfer submitted with an idempotency key:
+// From, To and Amount for a single transfer, Legs for a multi-leg one.
+type KeyedTransfer struct {
+	TxID   uint64
+	From   int
+	To     int
+	Amount int
+	Legs   []Leg
+	// At is when the transfer was submitted.
+	At time.Time
+}
+
+// RecoveredState is the bank state rebuilt from a transaction log.
+type RecoveredState struct {
+	Balances map[int]int
+	// RolledBack lists the transfers that were prepared but never committed
+	// or aborted.
+	RolledBack []uint64
+	// Refs holds the references of the committed deposits and withdrawals.
+	Refs map[string]bool
+	// Keys maps the idempotency keys of the committed transfers to them.
+	Keys       map[string]KeyedTransfer
+	Limits     map[int]int
+	Currencies map[int]string
+	// Houses maps each currency to its FX house account.
+	Houses map[string]int
+	// Holds are the holds neither captured nor released.
+	Holds map[uint64]Hold
+	// Scheduled are the scheduled transfers that have not run yet.
+	Scheduled []Scheduled
+	NextID    int
+	NextTxID  uint64
+	// LogSize is the length of the complete records in the log.
+	LogSize int64
+}
+
+// Recover replays the log at path: accounts start from their open balance and
+// only committed transfers are applied.
+func Recover(path string) (*RecoveredState, error) {
+	records, size, err := ReadLog(path)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &RecoveredState{
+		Balances:   make(map[int]int),
+		Refs:       make(map[string]bool),
+		Keys:       make(map[string]KeyedTransfer),
+		Limits:     make(map[int]int),
+		Currencies: make(map[int]string),
+		Houses:     make(map[string]int),
+		Holds:      make(map[uint64]Hold),
+		NextID:     1,
+		NextTxID:   1,
+		LogSize:    size,
+	}
+	prepared := make(map[uint64]Record)
+	scheduled := make(map[uint64]Record)
+	for _, rec := range records {
+		if rec.TxID > 0 {
+			state.NextTxID = max(state.NextTxID, rec.TxID+1)
+		}
+		switch rec.Type {
+		case RecordOpen:
+			state.Balances[rec.Account] = rec.Balance
+			state.Currencies[rec.Account] = rec.Currency
+			if rec.House {
+				state.Houses[rec.Currency] = rec.Account
+			}
+			state.NextID = max(state.NextID, rec.Account+1)
+		case RecordPrepare:
+			prepared[rec.TxID] = rec
+		case RecordCommit:
+			tran, ok := prepared[rec.TxID]
+			if !ok {
+				return nil, fmt.Errorf("commit of unknown transfer %d", rec.TxID)
+			}
+			if tran.Legs != nil {
+				for _, leg := range tran.Legs {
+					state.Balances[leg.Account] += leg.Amount
+				}
+			} else {
+				state.Balances[tran.From] -= tran.Amount
+				state.Balances[tran.To] += tran.Amount
+			}
+			if tran.Ref != "" {
+				state.Refs[tran.Ref] = true
+			}
+			if tran.Key != "" {
+				state.Keys[tran.Key] = KeyedTransfer{TxID: tran.TxID, From: tran.From, To: tran.To, Amount: tran.Amount, Legs: tran.Legs, At: tran.At}
+			}
+			delete(prepared, rec.TxID)
+		case RecordAbort:
+			delete(prepared, rec.TxID)
+		case RecordLimit:
+			state.Limits[rec.Account] = rec.Limit
+		case RecordHold:
+			state.Holds[rec.TxID] = Hold{ID: rec.TxID, Account: rec.Account, Amount: rec.Amount, Ref: rec.Ref}
+		case RecordCapture:
+			if _, ok := state.Holds[rec.Hold]; !ok {
+				return nil, fmt.Errorf("capture of unknown hold %d", rec.Hold)
+			}
+			delete(state.Holds, rec.Hold)
+			state.Balances[rec.From] -= rec.Amount
+			state.Balances[rec.To] += rec.Amount
+		case RecordRelease:
+			if _, ok := state.Holds[rec.TxID]; !ok {
+				return nil, fmt.Errorf("release of unknown hold %d", rec.TxID)
+			}
+			delete(state.Holds, rec.TxID)
+		case RecordSchedule:
+			scheduled[rec.TxID] = rec
+		case RecordUnschedule:
+			delete(scheduled, rec.TxID)
+		default:
+			return nil, fmt.Errorf("unknown log record type %q", rec.Type)
+		}
+	}
+
+	for id := range prepared {
+		state.RolledBack = append(state.RolledBack, id)
+	}
+	sort.Slice(state.RolledBack, func(i, j int) bool { return state.RolledBack[i] < state.RolledBack[j] })
+	for id, rec := range scheduled {
+		if !state.Refs[scheduleRef(id)] {
+			state.Scheduled = append(state.Scheduled, Scheduled{ID: id, At: rec.At, From: rec.From, To: rec.To, Amount: rec.Amount})
+		}
+	}
+	sort.Slice(state.Scheduled, func(i, j int) bool { return state.Scheduled[i].ID < state.Scheduled[j].ID })
+	return state, nil
+}
@@ -0,0 +1,130 @@
+package bank
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadLog(t *testing.T) {
+	const open = `{"type":"open","account":1,"balance":100}` + "\n"
+	const prepare = `{"type":"prepare","tx":1,"from":1,"to":2,"amount":10}` + "\n"
+	tests := []struct {
+		name     string
+		content  *string
+		records  int
+		size     int64
+		corrupts bool
+	}{
+		{name: "missing", content: nil},
+		{name: "empty", content: ptr("")},
+		{name: "complete", content: ptr(open + prepare), records: 2, size: int64(len(open + prepare))},
+		{name: "torn tail", content: ptr(open + prepare[:20]), records: 1, size: int64(len(open))},
+		{name: "torn tail without newline", content: ptr(open + strings.TrimSuffix(prepare, "\n")), records: 1, size: int64(len(open))},
+		{name: "corrupt line", content: ptr(open + "{oops\n" + prepare), corrupts: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "wal")
+			if tt.content != nil {
+				if err := os.WriteFile(path, []byte(*tt.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			records, size, err := ReadLog(path)
+			if tt.corrupts {
+				if err == nil {
+					t.Fatal("corrupt log read without error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != tt.records || size != tt.size {
+				t.Errorf("got %d records, %d bytes; want %d records, %d bytes", len(records), size, tt.records, tt.size)
+			}
+		})
+	}
+}
+
+func ptr(s string) *string { return &s }
+
+func TestRecoverAfterTornTail(t *testing.T) {
+	for _, engine := range Engines {
+		t.Run(string(engine), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "wal")
+			cfg := Config{Engine: engine, LogPath: path}
+
+			b := newTestBank(t, cfg)
+			a1, _ := b.OpenAccount(100)
+			a2, _ := b.OpenAccount(50)
+			transfer(t, b, a1, a2, 30)
+			b.Close()
+
+			// A crash in the middle of the next record.
+			file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.WriteString(`{"type":"prepare","tx":9,"fr`)
+			file.Close()
+
+			b = newTestBank(t, cfg)
+			transfer(t, b, a2, a1, 5)
+			b.Close()
+
+			b = newTestBank(t, cfg)
+			defer b.Close()
+			for id, want := range map[int]int{a1: 75, a2: 75} {
+				if got, _ := b.Balance(id); got != want {
+					t.Errorf("account %d: balance %d, want %d", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecoverRollsBackPrepared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	content := `{"type":"open","account":1,"balance":100}
+{"type":"open","account":2}
+{"type":"prepare","tx":1,"from":1,"to":2,"amount":10}
+{"type":"commit","tx":1}
+{"type":"prepare","tx":2,"from":1,"to":2,"amount":20}
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	state, err := Recover(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Balances[1] != 90 || state.Balances[2] != 10 {
+		t.Errorf("balances %v, want 90 and 10", state.Balances)
+	}
+	if len(state.RolledBack) != 1 || state.RolledBack[0] != 2 {
+		t.Errorf("rolled back %v, want [2]", state.RolledBack)
+	}
+	if state.NextID != 3 || state.NextTxID != 3 {
+		t.Errorf("next account %d, next transfer %d; want 3 and 3", state.NextID, state.NextTxID)
+	}
+}
+
+func newTestBank(t *testing.T, cfg Config) *Bank {
+	t.Helper()
+	b, err := NewBank(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func transfer(t *testing.T, b *Bank, from, to, amount int) {
+	t.Helper()
+	if _, err := b.Transfer(context.Background(), from, to, amount); err != nil {
+		t.Fatalf("transfer %d from %d to %d: %v", amount, from, to, err)
+	}
+}
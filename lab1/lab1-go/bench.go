@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"lab1-go/bank"
+	"lab1-go/workload"
+	"log"
+	"sort"
+	"time"
+)
+
+// runBenchmark replays the same workload against every engine.
+func runBenchmark(w *workload.Workload, clients int) {
+	fmt.Printf("Benchmark: %d accounts, %d operations, %d clients, seed %d\n\n", len(w.Balances), len(w.Ops), clients, w.Seed)
+	fmt.Printf("%-12s %10s %12s %10s %10s %10s %10s %6s\n", "engine", "time", "transfers/s", "p50", "p99", "max", "committed", "ok")
+	for _, kind := range bank.Engines {
+		b, err := bank.NewBank(bank.Config{Engine: kind, QueueSize: clients})
+		if err != nil {
+			log.Fatal(err)
+		}
+		ids, err := w.OpenAccounts(b)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		start := time.Now()
+		outcomes := w.Replay(context.Background(), b, ids, clients)
+		elapsed := time.Since(start)
+		snap := b.Snapshot()
+		b.Close()
+
+		latencies := make([]time.Duration, len(outcomes))
+		for i, outcome := range outcomes {
+			latencies[i] = outcome.Latency
+		}
+		p := percentiles(latencies)
+		fmt.Printf("%-12s %10v %12.0f %10v %10v %10v %10d %6v\n",
+			kind, elapsed.Round(time.Millisecond), float64(len(outcomes))/elapsed.Seconds(),
+			p(0.50), p(0.99), p(1), b.Stats().Committed, snap.Consistent())
+	}
+}
+
+func percentiles(latencies []time.Duration) func(q float64) time.Duration {
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return func(q float64) time.Duration {
+		if len(sorted) == 0 {
+			return 0
+		}
+		idx := int(q * float64(len(sorted)-1))
+		return sorted[idx].Round(time.Microsecond)
+	}
+}
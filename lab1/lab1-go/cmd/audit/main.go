@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"lab1-go/audit"
+	"log"
+	"os"
+)
+
+// audit replays a trail saved with -audit-out against the final balances
+// stored in it and prints every account whose balance does not add up.
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s trail.json\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	trail, err := audit.LoadTrail(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if trail.Final == nil {
+		log.Fatalf("%s holds no final balances", flag.Arg(0))
+	}
+	report := audit.Verify(trail, trail.Final)
+	audit.PrintReport(os.Stdout, report)
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
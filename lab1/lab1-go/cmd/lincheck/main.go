@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"lab1-go/lincheck"
+	"log"
+	"os"
+	"time"
+)
+
+// lincheck checks a history recorded with -history-out offline and prints a
+// minimal counterexample when it is not linearizable.
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-timeout d] history.json\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	timeout := flag.Duration("timeout", time.Minute, "give up the search after this long (0 means no limit)")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	h, err := lincheck.LoadHistory(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	start := time.Now()
+	report := lincheck.Check(h, *timeout)
+	fmt.Printf("Checked %d of %d operations in %v\n", report.Checked, len(h.Ops), time.Since(start).Round(time.Millisecond))
+	lincheck.PrintReport(os.Stdout, report)
+	if !report.Linearizable {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"lab1-go/bank"
+	"lab1-go/server"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	engine := flag.String("engine", string(bank.EngineChannel), "transfer engine: channel, lock or optimistic")
+	maxDelay := flag.Duration("delay", 0, "maximum processing delay per leg (channel engine)")
+	timeout := flag.Duration("timeout", 5*time.Second, "per transfer timeout (0 means none)")
+	logPath := flag.String("log", "", "transaction log file (replayed on startup if it exists)")
+	syncLog := flag.Bool("fsync", false, "fsync the transaction log after every record")
+	keyTTL := flag.Duration("key-ttl", server.DefaultOptions.KeyTTL, "how long finished transfers and their idempotency keys are remembered")
+	maxTransfers := flag.Int("max-transfers", server.DefaultOptions.MaxTransfers, "finished transfers remembered at most")
+	flag.Parse()
+
+	b, err := bank.NewBank(bank.Config{
+		Engine:          bank.EngineKind(*engine),
+		MaxDelay:        *maxDelay,
+		TransferTimeout: *timeout,
+		LogPath:         *logPath,
+		SyncLog:         *syncLog,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	srv := &http.Server{Addr: *addr, Handler: server.New(context.Background(), b, server.Options{KeyTTL: *keyTTL, MaxTransfers: *maxTransfers}).Handler()}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+		b.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("bank server (%s engine) listening on %s", *engine, *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-stopped
+}
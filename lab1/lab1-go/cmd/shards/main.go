@@ -0,0 +1,243 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"lab1-go/bank"
+	"lab1-go/shard"
+	"log"
+	"math/rand"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// The launcher starts every shard as a child process running this same
+// binary with -serve, drives a random cross-shard workload against them and
+// checks that the money adds up once all two-phase commits are resolved.
+func main() {
+	serve := flag.Int("serve", -1, "run shard with this ID instead of the launcher")
+	shards := flag.Int("shards", 3, "number of shards")
+	basePort := flag.Int("base-port", 9300, "port of shard 0; shard i listens on base-port+i")
+	dataDir := flag.String("data", "", "directory for the shard logs (a temporary one by default)")
+	engine := flag.String("engine", string(bank.EngineChannel), "transfer engine inside each shard")
+	accNr := flag.Int("accounts", 30, "number of accounts")
+	tranNr := flag.Int("transfers", 2000, "number of transfers")
+	clients := flag.Int("clients", 16, "concurrent clients")
+	maxTranAmount := flag.Int("max-amount", 500, "maximum transfer amount")
+	maxAccStartBalance := flag.Int("max-balance", 1000, "maximum initial account balance")
+	crash := flag.Bool("crash", false, "kill shard 0 half way through and restart it")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed")
+	flag.Parse()
+
+	addrs := make([]string, *shards)
+	for i := range addrs {
+		addrs[i] = "localhost:" + strconv.Itoa(*basePort+i)
+	}
+
+	if *serve >= 0 {
+		runShard(*serve, addrs, *dataDir, bank.EngineKind(*engine))
+		return
+	}
+
+	if *dataDir == "" {
+		dir, err := os.MkdirTemp("", "shards")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		*dataDir = dir
+	}
+	l := &launcher{addrs: addrs, dataDir: *dataDir, engine: *engine, procs: make([]*exec.Cmd, *shards)}
+	for i := range addrs {
+		l.start(i)
+	}
+	defer l.stopAll()
+
+	rng := rand.New(rand.NewSource(*seed))
+	ids := make([]int, *accNr)
+	initial := 0
+	for i := range ids {
+		balance := rng.Intn(*maxAccStartBalance)
+		if err := l.call(i%*shards, "OpenAccount", balance, &ids[i]); err != nil {
+			log.Fatal(err)
+		}
+		initial += balance
+	}
+	fmt.Printf("Opened %d accounts on %d shards, total %d\n", *accNr, *shards, initial)
+
+	type op struct{ from, to, amount int }
+	ops := make([]op, *tranNr)
+	for i := range ops {
+		from, to := rng.Intn(*accNr), rng.Intn(*accNr)
+		for from == to {
+			to = rng.Intn(*accNr)
+		}
+		ops[i] = op{ids[from], ids[to], 1 + rng.Intn(*maxTranAmount)}
+	}
+
+	var counts [bank.StatusFailed + 1]atomic.Int64
+	var unreachable, sent atomic.Int64
+	next := make(chan op)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for c := 0; c < *clients; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for o := range next {
+				var reply shard.TransferReply
+				err := l.call(shard.ShardOf(o.from, *shards), "Transfer", shard.TransferArgs{From: o.from, To: o.to, Amount: o.amount}, &reply)
+				if err != nil {
+					unreachable.Add(1)
+				} else {
+					counts[reply.Status].Add(1)
+				}
+				if sent.Add(1) == int64(len(ops)/2) && *crash {
+					l.crash(0)
+				}
+			}
+		}()
+	}
+	for _, o := range ops {
+		next <- o
+	}
+	close(next)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	fmt.Printf("\nTransfers took %v\n", elapsed.Round(time.Millisecond))
+	for status := bank.StatusCommitted; status <= bank.StatusFailed; status++ {
+		if n := counts[status].Load(); n > 0 {
+			fmt.Printf("%s: %d\n", status, n)
+		}
+	}
+	if n := unreachable.Load(); n > 0 {
+		fmt.Printf("shard unreachable: %d\n", n)
+	}
+
+	fmt.Println("\nWaiting for all two-phase commits to resolve...")
+	total := l.settledTotal(30 * time.Second)
+	if total != initial {
+		fmt.Printf("Total mismatch! Expected %d, found %d\n", initial, total)
+		os.Exit(1)
+	}
+	fmt.Printf("Total consistent: %d\n", total)
+}
+
+func runShard(id int, addrs []string, dataDir string, engine bank.EngineKind) {
+	s, err := shard.New(shard.Config{
+		ID:             id,
+		Addrs:          addrs,
+		DataDir:        dataDir,
+		Bank:           bank.Config{Engine: engine, TransferTimeout: time.Second},
+		RPCTimeout:     time.Second,
+		PrepareTimeout: time.Second,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		s.Close()
+	}()
+	if err := s.Serve(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type launcher struct {
+	addrs   []string
+	dataDir string
+	engine  string
+
+	mu    sync.Mutex
+	procs []*exec.Cmd
+}
+
+func (l *launcher) start(id int) {
+	cmd := exec.Command(os.Args[0], "-serve", strconv.Itoa(id), "-shards", strconv.Itoa(len(l.addrs)),
+		"-base-port", l.addrs[0][len("localhost:"):], "-data", l.dataDir, "-engine", l.engine)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		log.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		conn, err := net.Dial("tcp", l.addrs[id])
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			log.Fatalf("shard %d did not start: %v", id, err)
+		}
+	}
+	l.mu.Lock()
+	l.procs[id] = cmd
+	l.mu.Unlock()
+}
+
+// crash kills a shard without letting it shut down and restarts it from its
+// logs a moment later.
+func (l *launcher) crash(id int) {
+	l.mu.Lock()
+	cmd := l.procs[id]
+	l.mu.Unlock()
+	fmt.Printf("Killing shard %d\n", id)
+	cmd.Process.Kill()
+	cmd.Wait()
+	time.Sleep(500 * time.Millisecond)
+	l.start(id)
+	fmt.Printf("Restarted shard %d\n", id)
+}
+
+func (l *launcher) stopAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, cmd := range l.procs {
+		cmd.Process.Signal(os.Interrupt)
+		cmd.Wait()
+	}
+}
+
+func (l *launcher) call(id int, method string, args, reply any) error {
+	client, err := rpc.Dial("tcp", l.addrs[id])
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Call("Shard."+method, args, reply)
+}
+
+// settledTotal waits until no shard has a two-phase commit pending and sums
+// their totals.
+func (l *launcher) settledTotal(timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for {
+		total, pending := 0, 0
+		for id := range l.addrs {
+			var status shard.StatusReply
+			if err := l.call(id, "Status", 0, &status); err != nil {
+				log.Fatal(err)
+			}
+			total += status.Total
+			pending += status.Pending
+		}
+		if pending == 0 {
+			return total
+		}
+		if time.Now().After(deadline) {
+			log.Fatalf("%d two-phase commits still pending", pending)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
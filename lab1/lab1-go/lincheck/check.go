@@ -0,0 +1,469 @@
+package lincheck
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"lab1-go/bank"
+	"math"
+	"sort"
+	"time"
+)
+
+// Report is the verdict of Check.
+type Report struct {
+	Linearizable bool
+	// TimedOut is set when the search ran out of time. Without a
+	// counterexample the verdict is unknown; with one, the counterexample
+	// may not be minimal.
+	TimedOut bool
+	// Checked counts the operations with an effect or an observation;
+	// cancelled, failed and rejected-as-invalid transfers change nothing
+	// and are left out.
+	Checked int
+	// Counterexample is a relaxation of the history that cannot be
+	// linearized either, ordered by invocation. Shrinking forgets accounts
+	// and drops reads and transfers rejected for lack of funds, which only
+	// removes constraints, and marks committed transfers Optional; optional
+	// transfers invoked after every required operation returned cannot
+	// matter and are dropped too. Unless the check timed out, no single
+	// operation can be dropped or relaxed without the rest becoming
+	// linearizable.
+	Counterexample []Operation
+	// Longest is the longest valid order found for the counterexample;
+	// none of the remaining operations can follow it.
+	Longest []Operation
+}
+
+// Check reports whether the history is linearizable with respect to a
+// sequential bank: a transfer commits exactly when every debited account
+// has the funds, and a read returns the current balance. The search is
+// exponential in the number of concurrent operations and memoizes visited
+// states; it gives up after timeout (0 means no limit). In practice that
+// keeps histories to a handful of clients: 4 check quickly, 8 already
+// exhaust time or memory on a few thousand transfers.
+func Check(h History, timeout time.Duration) Report {
+	var ops []Operation
+	for _, op := range h.Ops {
+		if op.Kind == KindBalance || op.Status == bank.StatusCommitted || op.Status == bank.StatusInsufficientFunds {
+			ops = append(ops, op)
+		}
+	}
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].Call < ops[j].Call })
+
+	m := newModel(h)
+	if timeout > 0 {
+		m.deadline = time.Now().Add(timeout)
+	}
+	report := Report{Checked: len(ops)}
+	ok, _, finished := m.linearize(ops)
+	switch {
+	case !finished:
+		report.TimedOut = true
+		return report
+	case ok:
+		report.Linearizable = true
+		return report
+	}
+	report.Counterexample, report.TimedOut = m.shrink(ops)
+	_, report.Longest, _ = m.linearize(report.Counterexample)
+	return report
+}
+
+// model is the sequential specification over a dense account index.
+type model struct {
+	index     map[int]int
+	initial   []int
+	available []int // overdraft limit less holds, per account
+	deadline  time.Time
+}
+
+func newModel(h History) *model {
+	ids := make([]int, 0, len(h.Initial))
+	for id := range h.Initial {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	m := &model{index: make(map[int]int, len(ids)), initial: make([]int, len(ids)), available: make([]int, len(ids))}
+	for i, id := range ids {
+		m.index[id] = i
+		m.initial[i] = h.Initial[id]
+		m.available[i] = h.Limits[id] - h.Held[id]
+	}
+	return m
+}
+
+// step applies op to state and reports whether its recorded outcome is
+// possible there. state is never modified.
+func (m *model) step(state []int, op Operation) ([]int, bool) {
+	if op.Kind == KindBalance {
+		i, ok := m.index[op.Account]
+		return state, ok && state[i] == op.Balance
+	}
+	funded := true
+	for _, leg := range op.Legs {
+		i, ok := m.index[leg.Account]
+		if !ok {
+			return state, false
+		}
+		if leg.Amount < 0 && state[i]+m.available[i]+leg.Amount < 0 {
+			funded = false
+		}
+	}
+	if op.Status == bank.StatusInsufficientFunds {
+		return state, !funded
+	}
+	if !funded {
+		return state, false
+	}
+	next := append([]int(nil), state...)
+	for _, leg := range op.Legs {
+		next[m.index[leg.Account]] += leg.Amount
+	}
+	return next, true
+}
+
+// entry is a call or return event in the doubly linked history list used by
+// the Wing-Gong-Lowe search.
+type entry struct {
+	op         int
+	call       bool
+	time       int64
+	match      *entry
+	prev, next *entry
+}
+
+func buildList(ops []Operation) *entry {
+	events := make([]*entry, 0, 2*len(ops))
+	for i, op := range ops {
+		call := &entry{op: i, call: true, time: op.Call}
+		ret := &entry{op: i, time: op.Return}
+		if op.Optional {
+			ret.time = math.MaxInt64 // may stay pending to the end
+		}
+		call.match = ret
+		events = append(events, call, ret)
+	}
+	// on equal times calls go first, treating the operations as concurrent
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].time != events[j].time {
+			return events[i].time < events[j].time
+		}
+		return events[i].call && !events[j].call
+	})
+	head := &entry{op: -1}
+	prev := head
+	for _, e := range events {
+		prev.next, e.prev = e, prev
+		prev = e
+	}
+	return head
+}
+
+func (e *entry) lift() {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.match.prev.next = e.match.next
+	if e.match.next != nil {
+		e.match.next.prev = e.match.prev
+	}
+}
+
+func (e *entry) unlift() {
+	e.match.prev.next = e.match
+	if e.match.next != nil {
+		e.match.next.prev = e.match
+	}
+	e.prev.next = e
+	e.next.prev = e
+}
+
+// linearize searches for a valid order of ops and reports whether there is
+// one; when there is none it also returns the longest valid prefix found.
+// finished is false if the deadline passed before the search completed.
+func (m *model) linearize(ops []Operation) (ok bool, longest []Operation, finished bool) {
+	head := buildList(ops)
+	type frame struct {
+		call  *entry
+		state []int
+	}
+	var stack []frame
+	var best []int
+	state := m.initial
+	done := make([]byte, (len(ops)+7)/8)
+	seen := make(map[string]bool)
+
+	e := head.next
+	for steps := 0; head.next != nil; steps++ {
+		if steps%4096 == 0 && !m.deadline.IsZero() && time.Now().After(m.deadline) {
+			return false, nil, false
+		}
+		if e.call {
+			if next, ok := m.step(state, ops[e.op]); ok {
+				done[e.op/8] |= 1 << (e.op % 8)
+				key := cacheKey(done, next)
+				if !seen[key] {
+					seen[key] = true
+					stack = append(stack, frame{e, state})
+					state = next
+					e.lift()
+					e = head.next
+					if len(stack) > len(best) {
+						best = best[:0]
+						for _, f := range stack {
+							best = append(best, f.call.op)
+						}
+					}
+					continue
+				}
+				done[e.op/8] &^= 1 << (e.op % 8)
+			}
+			e = e.next
+			continue
+		}
+		// only optional operations are left pending
+		if ops[e.op].Optional {
+			return true, nil, true
+		}
+		// a return with its call still pending: some earlier choice was wrong
+		if len(stack) == 0 {
+			longest = make([]Operation, len(best))
+			for i, op := range best {
+				longest[i] = ops[op]
+			}
+			return false, longest, true
+		}
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		state = top.state
+		done[top.call.op/8] &^= 1 << (top.call.op % 8)
+		top.call.unlift()
+		e = top.call.next
+	}
+	return true, nil, true
+}
+
+func cacheKey(done []byte, state []int) string {
+	key := make([]byte, 0, len(done)+8*len(state))
+	key = append(key, done...)
+	for _, balance := range state {
+		key = binary.AppendVarint(key, int64(balance))
+	}
+	return string(key)
+}
+
+// shrink relaxes the history step by step as long as it still cannot be
+// linearized: it cuts the tail at the earliest invocation it can, forgets
+// accounts, drops reads and rejected transfers and finally makes committed
+// transfers optional. The last step goes one transfer at a time, since
+// every optional transfer stays pending and widens the search. It stops
+// early, reporting timedOut, when the deadline passes.
+func (m *model) shrink(ops []Operation) (counterexample []Operation, timedOut bool) {
+	// relaxing more of the tail only removes constraints, so the cut can be
+	// found by bisection
+	lo, hi := 0, len(ops)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		rest, _ := relax(ops, mid, len(ops), true)
+		ok, _, finished := m.linearize(rest)
+		if !finished {
+			return ops, true
+		}
+		if ok {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	current, _ := relax(ops, hi, len(ops), true)
+
+	countAccounts := func(ops []Operation) int { return len(accounts(ops)) }
+	countOps := func(ops []Operation) int { return len(ops) }
+	steps := []struct {
+		count     func([]Operation) int
+		halve     bool
+		transfers bool
+		relax     func(ops []Operation, start, end int) ([]Operation, bool)
+	}{
+		{count: countAccounts, halve: true, relax: forget},
+		{count: countOps, halve: true, relax: func(ops []Operation, start, end int) ([]Operation, bool) {
+			return relax(ops, start, end, false)
+		}},
+		{count: countOps, relax: func(ops []Operation, start, end int) ([]Operation, bool) {
+			return relax(ops, start, end, true)
+		}},
+	}
+	for _, step := range steps {
+		size := 1
+		if step.halve {
+			size = max(step.count(current)/2, 1)
+		}
+		var finished bool
+		if current, finished = m.minimize(current, size, step.count, step.relax); !finished {
+			return current, true
+		}
+	}
+	return current, false
+}
+
+// minimize relaxes chunks of the items of ops, starting from size and
+// halving it, as long as the rest still cannot be linearized. Chunks are
+// taken from the end so the items already kept keep their numbers; relax
+// reports false if the chunk had nothing to give.
+func (m *model) minimize(ops []Operation, size int, count func([]Operation) int, relax func(ops []Operation, start, end int) ([]Operation, bool)) ([]Operation, bool) {
+	current := ops
+	for {
+		changed := false
+		for end := count(current); end > 0; end -= size {
+			rest, ok := relax(current, max(end-size, 0), end)
+			if !ok {
+				continue
+			}
+			ok, _, finished := m.linearize(rest)
+			if !finished {
+				return current, false
+			}
+			if !ok {
+				current = rest
+				changed = true
+			}
+		}
+		if size == 1 && !changed {
+			return current, true
+		}
+		if !changed {
+			size = max(size/2, 1)
+		}
+		size = min(size, max(count(current)/2, 1))
+	}
+}
+
+// relax drops the reads and rejected transfers in ops[start:end] and, if
+// transfers is set, marks its committed transfers optional. It then drops
+// every optional transfer invoked after all required operations returned:
+// it is ordered after them and can always be left out. It reports false if
+// nothing changed.
+func relax(ops []Operation, start, end int, transfers bool) ([]Operation, bool) {
+	var rest []Operation
+	changed := false
+	for i, op := range ops {
+		if i >= start && i < end {
+			if op.Kind == KindBalance || op.Status != bank.StatusCommitted {
+				changed = true
+				continue
+			}
+			if transfers && !op.Optional {
+				op.Optional = true
+				changed = true
+			}
+		}
+		rest = append(rest, op)
+	}
+	var lastReturn int64
+	for _, op := range rest {
+		if !op.Optional {
+			lastReturn = max(lastReturn, op.Return)
+		}
+	}
+	kept := rest[:0]
+	for _, op := range rest {
+		if op.Optional && op.Call >= lastReturn {
+			changed = true
+			continue
+		}
+		kept = append(kept, op)
+	}
+	return kept, changed
+}
+
+// forget stops checking the accounts numbered start to end in ascending
+// order, as if they had unlimited funds and were never read: their reads
+// and legs go, and so do transfers rejected while touching them, since the
+// missing funds may have been theirs.
+func forget(ops []Operation, start, end int) ([]Operation, bool) {
+	gone := make(map[int]bool)
+	for _, id := range accounts(ops)[start:end] {
+		gone[id] = true
+	}
+	var rest []Operation
+	for _, op := range ops {
+		if op.Kind == KindBalance {
+			if !gone[op.Account] {
+				rest = append(rest, op)
+			}
+			continue
+		}
+		var legs []bank.Leg
+		for _, leg := range op.Legs {
+			if !gone[leg.Account] {
+				legs = append(legs, leg)
+			}
+		}
+		if len(legs) == 0 || len(legs) < len(op.Legs) && op.Status != bank.StatusCommitted {
+			continue
+		}
+		op.Legs = legs
+		rest = append(rest, op)
+	}
+	return rest, len(gone) > 0
+}
+
+// accounts returns the accounts ops touch in ascending order.
+func accounts(ops []Operation) []int {
+	seen := make(map[int]bool)
+	var ids []int
+	for _, op := range ops {
+		touched := op.Legs
+		if op.Kind == KindBalance {
+			touched = []bank.Leg{{Account: op.Account}}
+		}
+		for _, leg := range touched {
+			if !seen[leg.Account] {
+				seen[leg.Account] = true
+				ids = append(ids, leg.Account)
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// PrintReport writes the verdict of a check. For a failed check it lists the
+// counterexample, one operation per line, followed by the longest valid
+// order found.
+func PrintReport(w io.Writer, r Report) {
+	switch {
+	case r.Linearizable:
+		fmt.Fprintln(w, "History is linearizable")
+		return
+	case r.Counterexample == nil:
+		fmt.Fprintln(w, "Gave up: the search ran out of time (record fewer concurrent clients or raise the timeout)")
+		return
+	}
+	minimal := "minimal"
+	if r.TimedOut {
+		minimal = "unshrunk (ran out of time)"
+	}
+	fmt.Fprintf(w, "History is not linearizable; %s counterexample of %d operations:\n", minimal, len(r.Counterexample))
+	for _, op := range r.Counterexample {
+		fmt.Fprintf(w, "  %s\n", op)
+	}
+	if r.Longest == nil {
+		return
+	}
+	fmt.Fprintf(w, "Longest valid order (%d operations), nothing else can follow it:\n", len(r.Longest))
+	for _, op := range r.Longest {
+		fmt.Fprintf(w, "  %s\n", op)
+	}
+}
+
+func (op Operation) String() string {
+	span := fmt.Sprintf("#%d [%v, %v]", op.ID, time.Duration(op.Call), time.Duration(op.Return))
+	if op.Kind == KindBalance {
+		return fmt.Sprintf("%s balance(%d) = %d", span, op.Account, op.Balance)
+	}
+	if op.Optional {
+		return fmt.Sprintf("%s transfer%v -> %s (optional)", span, op.Legs, op.Status)
+	}
+	return fmt.Sprintf("%s transfer%v -> %s", span, op.Legs, op.Status)
+}
@@ -0,0 +1,84 @@
+package lincheck
+
+import (
+	"lab1-go/bank"
+	"testing"
+	"time"
+)
+
+func transfer(call, ret int64, from, to, amount int, status bank.Status) Operation {
+	return Operation{Kind: KindTransfer, Call: call, Return: ret, Legs: []bank.Leg{{Account: from, Amount: -amount}, {Account: to, Amount: amount}}, Status: status}
+}
+
+func balance(call, ret int64, account, value int) Operation {
+	return Operation{Kind: KindBalance, Call: call, Return: ret, Account: account, Balance: value}
+}
+
+func TestCheck(t *testing.T) {
+	committed, rejected := bank.StatusCommitted, bank.StatusInsufficientFunds
+	tests := []struct {
+		name           string
+		ops            []Operation
+		linearizable   bool
+		counterexample int
+	}{
+		{
+			name:         "sequential",
+			ops:          []Operation{transfer(0, 10, 1, 2, 50, committed), balance(20, 30, 2, 50), balance(20, 30, 1, 50)},
+			linearizable: true,
+		},
+		{
+			name:         "read overlapping the transfer sees either balance",
+			ops:          []Operation{transfer(0, 30, 1, 2, 50, committed), balance(10, 20, 2, 0), balance(10, 20, 1, 50)},
+			linearizable: true,
+		},
+		{
+			name:         "concurrent transfers, one rejected",
+			ops:          []Operation{transfer(0, 20, 1, 2, 80, committed), transfer(10, 30, 1, 2, 80, rejected), balance(40, 50, 1, 20)},
+			linearizable: true,
+		},
+		{
+			name: "stale read",
+			ops: []Operation{
+				transfer(0, 10, 1, 2, 50, committed),
+				balance(20, 30, 2, 0),
+				balance(40, 50, 1, 50),
+			},
+			counterexample: 2,
+		},
+		{
+			name:           "overdraft",
+			ops:            []Operation{transfer(0, 10, 1, 2, 150, committed)},
+			counterexample: 1,
+		},
+		{
+			name:           "rejected with the funds there",
+			ops:            []Operation{transfer(0, 10, 1, 2, 50, rejected), balance(20, 30, 1, 100)},
+			counterexample: 1,
+		},
+		{
+			name: "lost transfer",
+			ops: []Operation{
+				transfer(0, 10, 1, 2, 60, committed),
+				transfer(20, 30, 1, 2, 60, committed),
+				balance(40, 50, 2, 60),
+			},
+			counterexample: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := History{Initial: map[int]int{1: 100, 2: 0}, Ops: tt.ops}
+			r := Check(h, 10*time.Second)
+			if r.TimedOut {
+				t.Fatal("check timed out")
+			}
+			if r.Linearizable != tt.linearizable {
+				t.Fatalf("linearizable = %v, want %v", r.Linearizable, tt.linearizable)
+			}
+			if len(r.Counterexample) != tt.counterexample {
+				t.Errorf("counterexample of %d operations, want %d: %v", len(r.Counterexample), tt.counterexample, r.Counterexample)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package lincheck
+
+import (
+	"context"
+	"encoding/json"
+	"lab1-go/bank"
+	"os"
+	"sync"
+	"time"
+)
+
+type Kind string
+
+const (
+	KindTransfer Kind = "transfer"
+	KindBalance  Kind = "balance"
+)
+
+// Operation is one completed call. Call and Return are nanoseconds since the
+// recorder started; a transfer is stored as its legs, so plain and
+// multi-leg transfers look the same to the checker.
+type Operation struct {
+	ID     int         `json:"id"`
+	Kind   Kind        `json:"kind"`
+	Call   int64       `json:"call"`
+	Return int64       `json:"return"`
+	Legs   []bank.Leg  `json:"legs,omitempty"`
+	Status bank.Status `json:"status,omitempty"`
+	// Account and Balance are the input and output of a balance read.
+	Account int `json:"account,omitempty"`
+	Balance int `json:"balance,omitempty"`
+	// Optional marks a committed transfer in a counterexample that may be
+	// linearized anywhere after its call or not at all.
+	Optional bool `json:"-"`
+}
+
+// History is everything the checker needs: the state the bank started from
+// and the recorded operations. Holds and overdraft limits are taken as fixed
+// for the whole history.
+type History struct {
+	Initial map[int]int   `json:"initial"`
+	Limits  map[int]int   `json:"limits,omitempty"`
+	Held    map[int]int   `json:"held,omitempty"`
+	Ops     []Operation   `json:"ops"`
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// Recorder wraps a bank and records the invocation and response time of
+// every Transfer, TransferMulti and Balance call made through it.
+type Recorder struct {
+	bank    *bank.Bank
+	start   time.Time
+	initial bank.Snapshot
+
+	mu  sync.Mutex
+	ops []Operation
+}
+
+// NewRecorder snapshots b as the initial state; b must be idle while it does.
+func NewRecorder(b *bank.Bank) *Recorder {
+	return &Recorder{bank: b, start: time.Now(), initial: b.Snapshot()}
+}
+
+func (r *Recorder) now() int64 {
+	return int64(time.Since(r.start))
+}
+
+func (r *Recorder) add(op Operation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	op.ID = len(r.ops)
+	r.ops = append(r.ops, op)
+}
+
+func (r *Recorder) Transfer(ctx context.Context, from, to, amount int) (bank.Result, error) {
+	call := r.now()
+	res, err := r.bank.Transfer(ctx, from, to, amount)
+	ret := r.now()
+	r.add(Operation{
+		Kind:   KindTransfer,
+		Call:   call,
+		Return: ret,
+		Legs:   []bank.Leg{{Account: from, Amount: -amount}, {Account: to, Amount: amount}},
+		Status: res.Status,
+	})
+	return res, err
+}
+
+func (r *Recorder) TransferMulti(ctx context.Context, legs []bank.Leg) (bank.MultiResult, error) {
+	call := r.now()
+	res, err := r.bank.TransferMulti(ctx, legs)
+	ret := r.now()
+	r.add(Operation{Kind: KindTransfer, Call: call, Return: ret, Legs: append([]bank.Leg(nil), legs...), Status: res.Status})
+	return res, err
+}
+
+func (r *Recorder) Balance(id int) (int, error) {
+	call := r.now()
+	balance, err := r.bank.Balance(id)
+	ret := r.now()
+	if err == nil {
+		r.add(Operation{Kind: KindBalance, Call: call, Return: ret, Account: id, Balance: balance})
+	}
+	return balance, err
+}
+
+// History returns what was recorded so far.
+func (r *Recorder) History() History {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return History{
+		Initial: r.initial.Balances,
+		Limits:  r.initial.Limits,
+		Held:    r.initial.Held,
+		Ops:     append([]Operation(nil), r.ops...),
+		Elapsed: time.Since(r.start),
+	}
+}
+
+func (h History) Save(path string) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func LoadHistory(path string) (History, error) {
+	var h History
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return h, err
+	}
+	err = json.Unmarshal(data, &h)
+	return h, err
+}
@@ -1,29 +1,40 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"lab1-go/audit"
+	"lab1-go/bank"
+	"lab1-go/lincheck"
+	"lab1-go/metrics"
+	"lab1-go/workload"
+	"log"
 	"math/rand"
+	"net/http"
+	"os"
+	"sort"
 	"sync"
 	"time"
 )
 
-func checkBalance(accounts []*BankAccount, initialTotal int, done chan struct{}) {
+// checkBalance compares every snapshot with the total the bank must hold:
+// the opening balances plus the net effect of the batch jobs so far.
+func checkBalance(b *bank.Bank, interval time.Duration, done chan struct{}) {
 	go func() {
-		ticker := time.NewTicker(200 * time.Millisecond)
+		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				currentTotal := 0
-				for _, acc := range accounts {
-					acc.mu.Lock()
-					currentTotal += acc.Balance
-					acc.mu.Unlock()
-				}
-				if currentTotal-initialTotal != 0 {
-					fmt.Printf("Total mismatch! Expected %d, found %.d\n", initialTotal, currentTotal)
+				snap := b.Snapshot()
+				currentTotal := snap.Total
+				if currentTotal-snap.Expected != 0 {
+					fmt.Printf("Total mismatch! Expected %d, found %.d\n", snap.Expected, currentTotal)
+				} else if err := snap.Validate(); err != nil {
+					fmt.Printf("Invariant violated! %v\n", err)
 				} else {
-					fmt.Printf("Total consistent: %.d\n", currentTotal)
+					fmt.Printf("Total consistent: %.d (held %d)\n", currentTotal, snap.TotalHeld())
 				}
 			case <-done:
 				return
@@ -33,73 +44,341 @@ func checkBalance(accounts []*BankAccount, initialTotal int, done chan struct{})
 
 }
 
-func main() {
-	rand.Seed(time.Now().UnixNano())
-	var wg sync.WaitGroup
-	accNr := 20
-	tranNr := 1000
-	maxTranAmount := 500
-	maxAccStartBalance := 1000
-	accounts := make([]*BankAccount, accNr)
-
-	for i := 0; i < accNr; i++ {
-		accounts[i] = &BankAccount{
-			ID:      i + 1,
-			Balance: rand.Intn(maxAccStartBalance),
-			Ch:      make(chan Transaction, tranNr),
-		}
-		accounts[i].Start(&wg)
+func printBalances(b *bank.Bank) int {
+	total := 0
+	for _, id := range b.Accounts() {
+		balance, _ := b.Balance(id)
+		fmt.Printf("Account %d: %d\n", id, balance)
+		total += balance
 	}
+	return total
+}
 
-	fmt.Println("\nStart balances:")
-	total := 0
-	for _, acc := range accounts {
-		fmt.Printf("Account %d: %d\n", acc.ID, acc.Balance)
-		total += acc.Balance
+func printStats(stats bank.Stats) {
+	fmt.Println("\nTransfers:")
+	fmt.Printf("Submitted: %d\n", stats.Submitted)
+	fmt.Printf("Committed: %d\n", stats.Committed)
+	fmt.Printf("Rejected (insufficient funds): %d\n", stats.InsufficientFunds)
+	fmt.Printf("Rejected (unknown account): %d\n", stats.UnknownAccount)
+	fmt.Printf("Cancelled: %d\n", stats.Cancelled)
+	if stats.Failed > 0 {
+		fmt.Printf("Failed: %d\n", stats.Failed)
 	}
-	fmt.Printf("Total balance: %d\n\n", total)
+	if stats.Invalid > 0 {
+		fmt.Printf("Invalid: %d\n", stats.Invalid)
+	}
+}
 
-	start := time.Now() // record start time
-	for i := 0; i < tranNr; i++ {
-		fromId := rand.Intn(accNr)
-		toId := rand.Intn(accNr)
-		for fromId == toId {
-			toId = rand.Intn(accNr)
+// printMetrics summarizes where transfers spent their time and which accounts
+// were the most contended.
+func printMetrics(b *bank.Bank, top int) {
+	stats := b.Stats()
+	fmt.Println("\nLatency:")
+	fmt.Printf("%-11s %8s %10s %10s %10s\n", "phase", "count", "mean", "p50", "p99")
+	lat := b.Latencies()
+	for _, phase := range []struct {
+		name string
+		h    *metrics.Histogram
+	}{
+		{"queue wait", lat.QueueWait},
+		{"handshake", lat.Handshake},
+		{"apply", lat.Apply},
+		{"lock wait", lat.LockWait},
+	} {
+		fmt.Printf("%-11s %8d %10v %10v %10v\n", phase.name, phase.h.Count(),
+			phase.h.Mean(), phase.h.Quantile(0.5), phase.h.Quantile(0.99))
+	}
+	if stats.Submitted > 0 {
+		rejected := stats.InsufficientFunds + stats.UnknownAccount + stats.Invalid
+		fmt.Printf("Rejection rate: %.1f%%\n", 100*float64(rejected)/float64(stats.Submitted))
+	}
+	if retries := b.OptimisticRetries(); retries > 0 {
+		fmt.Printf("Optimistic retries: %d\n", retries)
+	}
+
+	accounts := b.AccountMetrics()
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].LockWait != accounts[j].LockWait {
+			return accounts[i].LockWait > accounts[j].LockWait
 		}
+		if accounts[i].MaxQueueDepth != accounts[j].MaxQueueDepth {
+			return accounts[i].MaxQueueDepth > accounts[j].MaxQueueDepth
+		}
+		return accounts[i].Transfers > accounts[j].Transfers
+	})
+	fmt.Println("\nMost contended accounts:")
+	fmt.Printf("%-8s %10s %12s %10s\n", "account", "transfers", "lock wait", "max queue")
+	for _, acc := range accounts[:min(top, len(accounts))] {
+		fmt.Printf("%-8d %10d %12v %10d\n", acc.ID, acc.Transfers, acc.LockWait, acc.MaxQueueDepth)
+	}
+}
 
-		fromAccount := accounts[fromId]
-		toAccount := accounts[toId]
+func main() {
+	accNr := flag.Int("accounts", 20, "number of accounts")
+	tranNr := flag.Int("transfers", 1000, "number of transfers")
+	maxTranAmount := flag.Int("max-amount", 500, "maximum transfer amount")
+	maxAccStartBalance := flag.Int("max-balance", 1000, "maximum initial account balance")
+	maxDelay := flag.Duration("delay", 50*time.Millisecond, "maximum processing delay per leg")
+	timeout := flag.Duration("timeout", 0, "per transfer timeout (0 means none)")
+	logPath := flag.String("log", "", "transaction log file (replayed on startup if it exists)")
+	syncLog := flag.Bool("fsync", false, "fsync the transaction log after every record")
+	checkInterval := flag.Duration("check", 200*time.Millisecond, "interval between consistency checks")
+	engine := flag.String("engine", string(bank.EngineChannel), "transfer engine: channel, lock or optimistic")
+	bench := flag.Bool("bench", false, "compare all engines on the same workload and exit")
+	clients := flag.Int("clients", 64, fmt.Sprintf("concurrent clients when the workload has no arrival times (at most %d with -history-out)", maxHistoryClients))
+	payouts := flag.Float64("payouts", 0.1, "fraction of operations that are multi-leg batch payouts")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed")
+	selection := flag.String("select", string(workload.SelectUniform), "account selection: uniform, zipf or hotspot")
+	zipfS := flag.Float64("zipf-s", 1.2, "zipf exponent (> 1)")
+	hotFraction := flag.Float64("hot-fraction", 0.1, "fraction of hot accounts for hotspot selection")
+	hotProbability := flag.Float64("hot-prob", 0.8, "probability of picking a hot account")
+	amounts := flag.String("amounts", string(workload.AmountUniform), "amount distribution: uniform, exponential or fixed")
+	meanAmount := flag.Float64("mean-amount", 100, "mean of exponential amounts")
+	rate := flag.Float64("rate", 0, "mean arrivals per second (0 submits back to back)")
+	workloadOut := flag.String("workload-out", "", "save the generated workload to this file")
+	workloadIn := flag.String("workload-in", "", "replay the workload stored in this file")
+	auditOut := flag.String("audit-out", "", "save the audit trail with the final balances to this file (check it with cmd/audit)")
+	historyOut := flag.String("history-out", "", "record every transfer and balance read, check the history for linearizability and save it to this file; needs a workload without arrival times")
+	historyTimeout := flag.Duration("history-timeout", time.Minute, "give up the linearizability check after this long (0 means no limit)")
+	readers := flag.Int("readers", 4, "concurrent balance readers while recording a history")
+	overdraft := flag.Int("overdraft", 0, "overdraft limit of every account")
+	jobEvery := flag.Duration("job-every", 0, "run the interest and fee batch jobs at this interval while transferring (0 means never)")
+	interest := flag.Float64("interest", 0.01, "interest rate credited by every interest job")
+	fee := flag.Int("fee", 1, "amount debited from every account by every fee job")
+	metricsAddr := flag.String("metrics", "", "serve Prometheus metrics on this address while running (e.g. :9090)")
+	flag.Parse()
 
-		tran := Transaction{
-			From:          fromAccount.ID,
-			To:            toAccount.ID,
-			Amount:        rand.Intn(maxTranAmount),
-			otherTxDoneCh: make(chan bool),
-		}
+	cfg := workload.Config{
+		Seed:           *seed,
+		Accounts:       *accNr,
+		Transfers:      *tranNr,
+		MaxBalance:     *maxAccStartBalance,
+		Selection:      workload.Selection(*selection),
+		ZipfS:          *zipfS,
+		HotFraction:    *hotFraction,
+		HotProbability: *hotProbability,
+		Amounts:        workload.AmountDist(*amounts),
+		MaxAmount:      *maxTranAmount,
+		MeanAmount:     *meanAmount,
+		Rate:           *rate,
+		PayoutFraction: *payouts,
+	}
+
+	if *historyOut != "" && *jobEvery > 0 {
+		log.Fatal("-history-out cannot be combined with -job-every: the checker does not model batch jobs")
+	}
+
+	if *bench {
+		w := loadWorkload(cfg, *workloadIn, *workloadOut)
+		runBenchmark(w, *clients)
+		return
+	}
+
+	recorder := audit.NewRecorder()
+	b, err := bank.NewBank(bank.Config{
+		Observer:        recorder,
+		Engine:          bank.EngineKind(*engine),
+		MaxDelay:        *maxDelay,
+		QueueSize:       *tranNr,
+		TransferTimeout: *timeout,
+		LogPath:         *logPath,
+		SyncLog:         *syncLog,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *metricsAddr != "" {
+		go serveMetrics(*metricsAddr, b)
+	}
 
-		// fmt.Printf("Starting new transaction between account %d: and account: %d with amount %d\n", fromAccount.ID, toAccount.ID, tran.Amount)
-		wg.Add(2)
-		fromAccount.Ch <- tran
-		toAccount.Ch <- tran
+	ids := b.Accounts()
+	if len(ids) > 0 {
+		fmt.Printf("Recovered %d accounts from %s, rolled back %d transfers\n",
+			len(ids), *logPath, len(b.Recovered().RolledBack))
+		cfg.Accounts = len(ids)
 	}
+	w := loadWorkload(cfg, *workloadIn, *workloadOut)
+	if *historyOut != "" {
+		if w.Timed() {
+			log.Fatal("-history-out needs a workload without arrival times: timed operations all run concurrently and the check cannot finish")
+		}
+		if *clients > maxHistoryClients {
+			fmt.Printf("Recording a history: using %d clients instead of %d\n", maxHistoryClients, *clients)
+			*clients = maxHistoryClients
+		}
+	}
+	if len(ids) == 0 {
+		if ids, err = w.OpenAccounts(b); err != nil {
+			log.Fatal(err)
+		}
+	} else if len(ids) != len(w.Balances) {
+		log.Fatalf("workload has %d accounts, the log recovered %d", len(w.Balances), len(ids))
+	}
+	if *overdraft > 0 {
+		for _, id := range ids {
+			if err := b.SetOverdraftLimit(id, *overdraft); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	fmt.Println("\nStart balances:")
+	total := printBalances(b)
+	fmt.Printf("Total balance: %d\n\n", total)
 
 	done := make(chan struct{})
-	checkBalance(accounts, total, done)
-	wg.Wait()
+	checkBalance(b, *checkInterval, done)
+	var target workload.Target = b
+	var history *lincheck.Recorder
+	stopReaders := make(chan struct{})
+	var readersDone sync.WaitGroup
+	if *historyOut != "" {
+		history = lincheck.NewRecorder(b)
+		target = history
+		for r := 0; r < *readers; r++ {
+			readersDone.Add(1)
+			go readBalances(history, ids, rand.New(rand.NewSource(*seed+int64(r))), stopReaders, &readersDone)
+		}
+	}
+	stopJobs := make(chan struct{})
+	jobsDone := make(chan jobTotals, 1)
+	if *jobEvery > 0 {
+		go runJobs(b, *jobEvery, bank.Interest(*interest), bank.Fee(*fee), stopJobs, jobsDone)
+	} else {
+		jobsDone <- jobTotals{}
+	}
+	start := time.Now() // record start time
+	w.Replay(context.Background(), target, ids, *clients)
+	close(stopReaders)
+	readersDone.Wait()
+	close(stopJobs)
+	jobs := <-jobsDone
 	done <- struct{}{}
 	end := time.Since(start)
 
-	for _, acc := range accounts {
-		close(acc.Ch)
-	}
+	b.Close()
 
 	fmt.Println("\nFinal balances:")
-	total = 0
-	for _, acc := range accounts {
-		fmt.Printf("Account %d: %d\n", acc.ID, acc.Balance)
-		total += acc.Balance
-	}
+	expected := total + jobs.net
+	total = printBalances(b)
 	fmt.Printf("Total balance: %d\n", total)
+	if jobs.runs > 0 {
+		fmt.Printf("Batch jobs: %d run, net %+d (%d debits capped), expected total %d\n", jobs.runs, jobs.net, jobs.capped, expected)
+	}
+	printStats(b.Stats())
+	printMetrics(b, 5)
+
+	trail := recorder.Trail()
+	trail.Final = b.Snapshot().Balances
+	if *auditOut != "" {
+		if err := trail.Save(*auditOut); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Println()
+	audit.PrintReport(os.Stdout, audit.Verify(trail, trail.Final))
+	if history != nil {
+		checkHistory(history.History(), *historyOut, *historyTimeout)
+	}
 	fmt.Printf("Transaction processing took: %d ms", end.Milliseconds())
 
 }
+
+type jobTotals struct {
+	runs   int
+	net    int
+	capped int
+}
+
+// runJobs alternates interest and fee jobs every interval until stop is
+// closed and reports what they added up to on done.
+func runJobs(b *bank.Bank, interval time.Duration, interest, fee bank.JobFunc, stop chan struct{}, done chan jobTotals) {
+	var totals jobTotals
+	defer func() { done <- totals }()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for day := 1; ; day++ {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		for _, job := range []struct {
+			name string
+			fn   bank.JobFunc
+		}{
+			{fmt.Sprintf("interest-%d", day), interest},
+			{fmt.Sprintf("fee-%d", day), fee},
+		} {
+			res, err := b.RunJob(job.name, job.fn)
+			if err != nil {
+				fmt.Printf("Job %s failed: %v\n", job.name, err)
+				continue
+			}
+			totals.runs++
+			totals.net += res.Total
+			totals.capped += res.Capped
+			fmt.Printf("Job %s: %+d over %d accounts\n", job.name, res.Total, len(res.Legs))
+		}
+	}
+}
+
+// readBalances reads random accounts through the recorder until stop is
+// closed, so the history has observations to check.
+func readBalances(r *lincheck.Recorder, ids []int, rng *rand.Rand, stop chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Millisecond):
+			r.Balance(ids[rng.Intn(len(ids))])
+		}
+	}
+}
+
+// maxHistoryClients bounds the clients while a history is recorded. The
+// linearizability search is exponential in the number of operations in
+// flight at once; with the default 64 clients it runs out of time or
+// memory on a history of any size, with 4 it checks a default run (about
+// 40,000 operations including the reads) in seconds.
+const maxHistoryClients = 4
+
+func checkHistory(h lincheck.History, path string, timeout time.Duration) {
+	if err := h.Save(path); err != nil {
+		log.Fatal(err)
+	}
+	report := lincheck.Check(h, timeout)
+	fmt.Printf("\nLinearizability: checked %d operations\n", report.Checked)
+	lincheck.PrintReport(os.Stdout, report)
+}
+
+func serveMetrics(addr string, b *bank.Bank) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", metrics.ContentType)
+		b.WriteMetrics(w)
+	})
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+// loadWorkload reads the workload from in if set, otherwise generates it from
+// cfg, and saves it to out if set.
+func loadWorkload(cfg workload.Config, in, out string) *workload.Workload {
+	var w *workload.Workload
+	var err error
+	if in != "" {
+		w, err = workload.Load(in)
+	} else {
+		w, err = workload.Generate(cfg)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if out != "" {
+		if err := w.Save(out); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return w
+}
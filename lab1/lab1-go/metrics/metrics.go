@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ContentType is the media type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are latency bucket upper bounds in seconds, from a
+// microsecond to ten seconds.
+var DefaultBuckets = []float64{
+	1e-6, 2.5e-6, 5e-6, 1e-5, 2.5e-5, 5e-5, 1e-4, 2.5e-4, 5e-4,
+	1e-3, 2.5e-3, 5e-3, 1e-2, 2.5e-2, 5e-2, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// Histogram counts durations into fixed buckets; it is safe for concurrent
+// use and never blocks.
+type Histogram struct {
+	bounds []float64
+	// counts has one extra slot for observations above the last bound.
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Int64
+}
+
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]atomic.Uint64, len(bounds)+1)}
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	idx := sort.SearchFloat64s(h.bounds, d.Seconds())
+	h.counts[idx].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+// ObserveSince records the time elapsed since start.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start))
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+func (h *Histogram) Sum() time.Duration {
+	return time.Duration(h.sum.Load())
+}
+
+func (h *Histogram) Mean() time.Duration {
+	count := h.Count()
+	if count == 0 {
+		return 0
+	}
+	return h.Sum() / time.Duration(count)
+}
+
+// Quantile returns the upper bound of the bucket holding the q-th quantile;
+// observations above the last bound report that bound.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	count := h.Count()
+	if count == 0 {
+		return 0
+	}
+	rank := max(uint64(math.Ceil(q*float64(count))), 1)
+	var seen uint64
+	for i, bound := range h.bounds {
+		seen += h.counts[i].Load()
+		if seen >= rank {
+			return time.Duration(bound * float64(time.Second))
+		}
+	}
+	return time.Duration(h.bounds[len(h.bounds)-1] * float64(time.Second))
+}
+
+// Exposition writes metrics in the Prometheus text format, emitting the
+// HELP and TYPE lines once per metric family.
+type Exposition struct {
+	w    io.Writer
+	seen map[string]bool
+}
+
+func NewExposition(w io.Writer) *Exposition {
+	return &Exposition{w: w, seen: make(map[string]bool)}
+}
+
+func (e *Exposition) header(name, help, typ string) {
+	if e.seen[name] {
+		return
+	}
+	e.seen[name] = true
+	fmt.Fprintf(e.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// Counter writes one sample; labels are key, value pairs.
+func (e *Exposition) Counter(name, help string, value float64, labels ...string) {
+	e.header(name, help, "counter")
+	fmt.Fprintf(e.w, "%s%s %v\n", name, formatLabels(labels), value)
+}
+
+func (e *Exposition) Gauge(name, help string, value float64, labels ...string) {
+	e.header(name, help, "gauge")
+	fmt.Fprintf(e.w, "%s%s %v\n", name, formatLabels(labels), value)
+}
+
+func (e *Exposition) Histogram(name, help string, h *Histogram, labels ...string) {
+	e.header(name, help, "histogram")
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i].Load()
+		fmt.Fprintf(e.w, "%s_bucket%s %d\n", name, formatLabels(append(labels, "le", fmt.Sprint(bound))), cumulative)
+	}
+	cumulative += h.counts[len(h.bounds)].Load()
+	fmt.Fprintf(e.w, "%s_bucket%s %d\n", name, formatLabels(append(labels, "le", "+Inf")), cumulative)
+	fmt.Fprintf(e.w, "%s_sum%s %v\n", name, formatLabels(labels), h.Sum().Seconds())
+	fmt.Fprintf(e.w, "%s_count%s %d\n", name, formatLabels(labels), cumulative)
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogramExposition(t *testing.T) {
+	h := NewHistogram([]float64{0.001, 0.01, 0.1})
+	for _, d := range []time.Duration{
+		500 * time.Microsecond,
+		time.Millisecond, // on a bound: counted in that bucket
+		5 * time.Millisecond,
+		50 * time.Millisecond,
+		2 * time.Second, // above every bound
+	} {
+		h.Observe(d)
+	}
+	empty := NewHistogram([]float64{0.001, 0.01, 0.1})
+
+	var out strings.Builder
+	e := NewExposition(&out)
+	e.Histogram("bank_apply_seconds", "Time to apply a transfer.", h, "engine", "lock")
+	e.Histogram("bank_apply_seconds", "Time to apply a transfer.", empty, "engine", "channel")
+	e.Counter("bank_transfers_total", "Transfers submitted.", 3)
+
+	want := `# HELP bank_apply_seconds Time to apply a transfer.
+# TYPE bank_apply_seconds histogram
+bank_apply_seconds_bucket{engine="lock",le="0.001"} 2
+bank_apply_seconds_bucket{engine="lock",le="0.01"} 3
+bank_apply_seconds_bucket{engine="lock",le="0.1"} 4
+bank_apply_seconds_bucket{engine="lock",le="+Inf"} 5
+bank_apply_seconds_sum{engine="lock"} 2.0565
+bank_apply_seconds_count{engine="lock"} 5
+bank_apply_seconds_bucket{engine="channel",le="0.001"} 0
+bank_apply_seconds_bucket{engine="channel",le="0.01"} 0
+bank_apply_seconds_bucket{engine="channel",le="0.1"} 0
+bank_apply_seconds_bucket{engine="channel",le="+Inf"} 0
+bank_apply_seconds_sum{engine="channel"} 0
+bank_apply_seconds_count{engine="channel"} 0
+# HELP bank_transfers_total Transfers submitted.
+# TYPE bank_transfers_total counter
+bank_transfers_total 3
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestHistogramStatistics(t *testing.T) {
+	h := NewHistogram([]float64{0.001, 0.01, 0.1})
+	if h.Quantile(0.5) != 0 || h.Mean() != 0 {
+		t.Errorf("empty histogram: median %v, mean %v", h.Quantile(0.5), h.Mean())
+	}
+	for _, d := range []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond, time.Second} {
+		h.Observe(d)
+	}
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{0.25, time.Millisecond},
+		{0.5, 10 * time.Millisecond},
+		{0.75, 10 * time.Millisecond},
+		// Above the last bound the last bound is all there is to report.
+		{1, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := h.Quantile(tt.q); got != tt.want {
+			t.Errorf("quantile %v: %v, want %v", tt.q, got, tt.want)
+		}
+	}
+	if h.Count() != 4 || h.Sum() != 1006*time.Millisecond || h.Mean() != 251500*time.Microsecond {
+		t.Errorf("count %d, sum %v, mean %v", h.Count(), h.Sum(), h.Mean())
+	}
+}
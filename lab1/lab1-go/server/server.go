@@ -0,0 +1,351 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"lab1-go/bank"
+	"lab1-go/metrics"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Server exposes a bank.Bank over HTTP/JSON.
+type Server struct {
+	bank *bank.Bank
+	// ctx bounds asynchronous transfers, which outlive their request.
+	ctx context.Context
+
+	opt       Options
+	mu        sync.Mutex
+	transfers map[int64]*transfer
+	keys      map[string]*transfer
+	// order holds the transfers oldest first, for eviction.
+	order  []*transfer
+	nextID int64
+}
+
+// Options bounds how long the server remembers transfers; zero fields take
+// their value from DefaultOptions.
+type Options struct {
+	// KeyTTL is how long a finished transfer and its idempotency key are
+	// kept; a retry arriving later runs the transfer again.
+	KeyTTL time.Duration
+	// MaxTransfers caps the finished transfers kept; the oldest go first.
+	MaxTransfers int
+}
+
+var DefaultOptions = Options{KeyTTL: 24 * time.Hour, MaxTransfers: 100_000}
+
+type TransferRequest struct {
+	From   int        `json:"from,omitempty"`
+	To     int        `json:"to,omitempty"`
+	Amount int        `json:"amount,omitempty"`
+	Legs   []bank.Leg `json:"legs,omitempty"`
+}
+
+type TransferStatus struct {
+	ID      int64           `json:"id"`
+	Request TransferRequest `json:"request"`
+	Status  string          `json:"status"`
+	Error   string          `json:"error,omitempty"`
+}
+
+type transfer struct {
+	TransferStatus
+	key     string
+	created time.Time
+	done    chan struct{}
+}
+
+// New returns a server for b. When b was recovered from a transaction log,
+// the idempotency keys of the transfers it committed are honoured again, so
+// a client retrying across a restart does not apply a transfer twice. Their
+// KeyTTL runs from when they were first submitted, not from the restart.
+func New(ctx context.Context, b *bank.Bank, opt Options) *Server {
+	if opt.KeyTTL <= 0 {
+		opt.KeyTTL = DefaultOptions.KeyTTL
+	}
+	if opt.MaxTransfers <= 0 {
+		opt.MaxTransfers = DefaultOptions.MaxTransfers
+	}
+	s := &Server{
+		bank:      b,
+		ctx:       ctx,
+		opt:       opt,
+		transfers: make(map[int64]*transfer),
+		keys:      make(map[string]*transfer),
+		nextID:    1,
+	}
+	if state := b.Recovered(); state != nil {
+		keys := make([]string, 0, len(state.Keys))
+		for key := range state.Keys {
+			keys = append(keys, key)
+		}
+		slices.SortFunc(keys, func(a, b string) int { return cmp.Compare(state.Keys[a].TxID, state.Keys[b].TxID) })
+		for _, key := range keys {
+			k := state.Keys[key]
+			req := TransferRequest{From: k.From, To: k.To, Amount: k.Amount, Legs: k.Legs}
+			created := k.At
+			if created.IsZero() {
+				created = time.Now()
+			}
+			t := s.add(req, key, created)
+			t.Status = bank.StatusCommitted.String()
+			close(t.done)
+		}
+		s.evict(time.Now())
+	}
+	return s
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /accounts", s.openAccount)
+	mux.HandleFunc("GET /accounts", s.listAccounts)
+	mux.HandleFunc("GET /accounts/{id}", s.getAccount)
+	mux.HandleFunc("POST /transfers", s.submitTransfer)
+	mux.HandleFunc("GET /transfers/{id}", s.getTransfer)
+	mux.HandleFunc("GET /total", s.total)
+	mux.HandleFunc("GET /stats", s.stats)
+	mux.HandleFunc("GET /metrics", s.metrics)
+	return mux
+}
+
+type account struct {
+	ID      int `json:"id"`
+	Balance int `json:"balance"`
+}
+
+func (s *Server) openAccount(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Balance int `json:"balance"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	id, err := s.bank.OpenAccount(req.Balance)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, account{ID: id, Balance: req.Balance})
+}
+
+func (s *Server) listAccounts(w http.ResponseWriter, r *http.Request) {
+	snap := s.bank.Snapshot()
+	accounts := make([]account, 0, len(snap.Balances))
+	for _, id := range s.bank.Accounts() {
+		if balance, ok := snap.Balances[id]; ok {
+			accounts = append(accounts, account{ID: id, Balance: balance})
+		}
+	}
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+func (s *Server) getAccount(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "bad account id", http.StatusBadRequest)
+		return
+	}
+	balance, err := s.bank.Balance(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, account{ID: id, Balance: balance})
+}
+
+// submitTransfer runs a transfer and answers with its final status, or with
+// 202 and the pending status if the request asks for ?async=true. A request
+// repeating an Idempotency-Key gets the original transfer back instead of
+// running it again.
+func (s *Server) submitTransfer(w http.ResponseWriter, r *http.Request) {
+	var req TransferRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	async := r.URL.Query().Get("async") == "true"
+	key := r.Header.Get("Idempotency-Key")
+
+	now := time.Now()
+	s.mu.Lock()
+	s.evict(now)
+	if t, ok := s.keys[key]; ok && key != "" {
+		s.mu.Unlock()
+		if !reflect.DeepEqual(normalize(t.Request), normalize(req)) {
+			http.Error(w, "idempotency key reused with a different request", http.StatusUnprocessableEntity)
+			return
+		}
+		s.respond(w, r, t, async)
+		return
+	}
+	t := s.add(req, key, now)
+	s.mu.Unlock()
+
+	// the transfer must not depend on this request: a client that retries
+	// after a dropped connection has to find it finished, not cancelled
+	go s.run(t)
+	s.respond(w, r, t, async)
+}
+
+// add registers a pending transfer; it is called with mu held.
+func (s *Server) add(req TransferRequest, key string, now time.Time) *transfer {
+	t := &transfer{
+		TransferStatus: TransferStatus{ID: s.nextID, Request: req, Status: bank.StatusPending.String()},
+		key:            key,
+		created:        now,
+		done:           make(chan struct{}),
+	}
+	s.nextID++
+	s.transfers[t.ID] = t
+	if key != "" {
+		s.keys[key] = t
+	}
+	s.order = append(s.order, t)
+	return t
+}
+
+// evict forgets the oldest finished transfers while there are more than
+// MaxTransfers or they are older than KeyTTL. A transfer still running is
+// kept, and so is everything after it. It is called with mu held.
+func (s *Server) evict(now time.Time) {
+	n := 0
+	for ; n < len(s.order); n++ {
+		t := s.order[n]
+		if len(s.order)-n <= s.opt.MaxTransfers && now.Sub(t.created) < s.opt.KeyTTL {
+			break
+		}
+		if t.Status == bank.StatusPending.String() {
+			break
+		}
+		delete(s.transfers, t.ID)
+		if t.key != "" && s.keys[t.key] == t {
+			delete(s.keys, t.key)
+		}
+	}
+	clear(s.order[:n])
+	s.order = s.order[n:]
+}
+
+// normalize sorts the legs of req the way the bank logs them, so a request
+// rebuilt from the log compares equal to the original.
+func normalize(req TransferRequest) TransferRequest {
+	req.Legs = slices.Clone(req.Legs)
+	slices.SortFunc(req.Legs, func(a, b bank.Leg) int { return a.Account - b.Account })
+	return req
+}
+
+func (s *Server) run(t *transfer) {
+	var status bank.Status
+	var err error
+	if t.Request.Legs != nil {
+		var res bank.MultiResult
+		res, err = s.bank.TransferMultiWithKey(s.ctx, t.key, t.Request.Legs)
+		status = res.Status
+	} else {
+		var res bank.Result
+		res, err = s.bank.TransferWithKey(s.ctx, t.key, t.Request.From, t.Request.To, t.Request.Amount)
+		status = res.Status
+	}
+
+	s.mu.Lock()
+	t.Status = status.String()
+	if err != nil {
+		t.Error = err.Error()
+	}
+	s.mu.Unlock()
+	close(t.done)
+}
+
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, t *transfer, async bool) {
+	code := http.StatusOK
+	if async {
+		code = http.StatusAccepted
+	} else {
+		select {
+		case <-t.done:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	s.mu.Lock()
+	status := t.TransferStatus
+	s.mu.Unlock()
+	writeJSON(w, code, status)
+}
+
+func (s *Server) getTransfer(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad transfer id", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	t, ok := s.transfers[id]
+	var status TransferStatus
+	if ok {
+		status = t.TransferStatus
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown transfer", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) total(w http.ResponseWriter, r *http.Request) {
+	snap := s.bank.Snapshot()
+	writeJSON(w, http.StatusOK, struct {
+		Total          int            `json:"total"`
+		Expected       int            `json:"expected"`
+		Totals         map[string]int `json:"totals"`
+		ExpectedTotals map[string]int `json:"expected_totals"`
+		Consistent     bool           `json:"consistent"`
+	}{snap.Total, snap.Expected, snap.Totals, snap.ExpectedTotals, snap.Consistent()})
+}
+
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.bank.Stats())
+}
+
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	s.bank.WriteMetrics(w)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		http.Error(w, "bad request body: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, bank.ErrUnknownAccount):
+		code = http.StatusNotFound
+	case errors.Is(err, bank.ErrInvalidAmount):
+		code = http.StatusBadRequest
+	case errors.Is(err, bank.ErrClosed):
+		code = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), code)
+}
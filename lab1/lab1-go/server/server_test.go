@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"lab1-go/bank"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestBank(t *testing.T, logPath string) *bank.Bank {
+	t.Helper()
+	b, err := bank.NewBank(bank.Config{Engine: bank.EngineChannel, LogPath: logPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func post(t *testing.T, h http.Handler, path, key string, body any) (int, TransferStatus) {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var status TransferStatus
+	json.Unmarshal(rec.Body.Bytes(), &status)
+	return rec.Code, status
+}
+
+func TestIdempotencyKeySurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	b := newTestBank(t, path)
+	a1, _ := b.OpenAccount(100)
+	a2, _ := b.OpenAccount(0)
+	h := New(context.Background(), b, Options{}).Handler()
+	single := TransferRequest{From: a1, To: a2, Amount: 30}
+	multi := TransferRequest{Legs: []bank.Leg{{Account: a2, Amount: 10}, {Account: a1, Amount: -10}}}
+	if code, st := post(t, h, "/transfers", "k1", single); code != http.StatusOK || st.Status != "committed" {
+		t.Fatalf("first submit: %d %+v", code, st)
+	}
+	if code, st := post(t, h, "/transfers", "k2", multi); code != http.StatusOK || st.Status != "committed" {
+		t.Fatalf("first multi submit: %d %+v", code, st)
+	}
+	if _, st := post(t, h, "/transfers", "k1", single); st.ID != 1 {
+		t.Fatalf("retry got transfer %d, want 1", st.ID)
+	}
+	b.Close()
+
+	b = newTestBank(t, path)
+	defer b.Close()
+	h = New(context.Background(), b, Options{}).Handler()
+	for key, req := range map[string]TransferRequest{"k1": single, "k2": multi} {
+		if code, st := post(t, h, "/transfers", key, req); code != http.StatusOK || st.Status != "committed" {
+			t.Fatalf("retry of %s after restart: %d %+v", key, code, st)
+		}
+	}
+	if code, _ := post(t, h, "/transfers", "k1", TransferRequest{From: a1, To: a2, Amount: 31}); code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused for another request: %d", code)
+	}
+	if balance, _ := b.Balance(a1); balance != 60 {
+		t.Errorf("balance %d after retries, want 60", balance)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     Options
+		wait    time.Duration
+		restart bool
+		kept    int
+	}{
+		{name: "under the limits", opt: Options{KeyTTL: time.Hour, MaxTransfers: 10}, kept: 5},
+		{name: "size cap", opt: Options{KeyTTL: time.Hour, MaxTransfers: 2}, kept: 2},
+		{name: "ttl", opt: Options{KeyTTL: time.Millisecond, MaxTransfers: 10}, wait: 5 * time.Millisecond, kept: 0},
+		{name: "restart within the ttl", opt: Options{KeyTTL: time.Hour, MaxTransfers: 10}, restart: true, kept: 5},
+		{name: "size cap across a restart", opt: Options{KeyTTL: time.Hour, MaxTransfers: 2}, restart: true, kept: 2},
+		// The keys expired before the restart and must not come back.
+		{name: "ttl across a restart", opt: Options{KeyTTL: time.Millisecond, MaxTransfers: 10}, wait: 5 * time.Millisecond, restart: true, kept: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.restart {
+				path = filepath.Join(t.TempDir(), "wal")
+			}
+			b := newTestBank(t, path)
+			defer func() { b.Close() }()
+			a1, _ := b.OpenAccount(100)
+			a2, _ := b.OpenAccount(0)
+			s := New(context.Background(), b, tt.opt)
+			h := s.Handler()
+			for i := range 5 {
+				post(t, h, "/transfers", string(rune('a'+i)), TransferRequest{From: a1, To: a2, Amount: 1})
+			}
+			time.Sleep(tt.wait)
+			if tt.restart {
+				b.Close()
+				b = newTestBank(t, path)
+				s = New(context.Background(), b, tt.opt)
+			}
+			s.mu.Lock()
+			s.evict(time.Now())
+			transfers, keys := len(s.transfers), len(s.keys)
+			s.mu.Unlock()
+			if transfers != tt.kept || keys != tt.kept {
+				t.Errorf("kept %d transfers and %d keys, want %d", transfers, keys, tt.kept)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package shard
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+type entryKind string
+
+const (
+	// entryPrepared is written by a participant before it acts on a prepare.
+	entryPrepared entryKind = "prepared"
+	// entryOutcome is the participant learning the decision.
+	entryOutcome entryKind = "outcome"
+	// entryDecision is the coordinator's commit point.
+	entryDecision entryKind = "decision"
+	// entryDone means every participant acknowledged the decision.
+	entryDone entryKind = "done"
+)
+
+type entry struct {
+	Kind         entryKind `json:"kind"`
+	TxID         uint64    `json:"tx"`
+	Account      int       `json:"account,omitempty"`
+	Delta        int       `json:"delta,omitempty"`
+	Commit       bool      `json:"commit,omitempty"`
+	Participants []int     `json:"participants,omitempty"`
+}
+
+// decisionLog is the shard's two-phase commit log. It is always synced:
+// a decision that is not on disk may not be acted upon.
+type decisionLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openDecisionLog reads the log at path and reopens it for appending, with
+// a torn last line cut off so the next entry starts on a line of its own.
+func openDecisionLog(path string) (*decisionLog, []entry, error) {
+	entries, size, err := readEntries(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := truncate(file, size); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return &decisionLog{file: file}, entries, nil
+}
+
+// readEntries returns the complete entries of the log at path and their
+// length in bytes.
+func readEntries(path string) ([]entry, int64, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var entries []entry
+	var size int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// a torn last line was never acted upon
+			return entries, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+		size += int64(len(line))
+	}
+}
+
+func truncate(file *os.File, size int64) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == size {
+		return nil
+	}
+	if err := file.Truncate(size); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// append is a no-op on a nil log, which is how shards without a data
+// directory run.
+func (l *decisionLog) append(e entry) error {
+	if l == nil {
+		return nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+func (l *decisionLog) close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
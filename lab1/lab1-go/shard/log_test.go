@@ -0,0 +1,67 @@
+package shard
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDecisionLogReopen(t *testing.T) {
+	decided := []entry{
+		{Kind: entryDecision, TxID: 1, Commit: true, Participants: []int{0, 1}},
+		{Kind: entryDone, TxID: 1},
+	}
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{name: "clean"},
+		{name: "torn entry", tail: `{"kind":"decision","tx":2,"com`},
+		{name: "torn newline", tail: `{"kind":"decision","tx":2}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "2pc.log")
+			l, entries, err := openDecisionLog(path)
+			if err != nil || len(entries) != 0 {
+				t.Fatalf("new log: %v, %d entries", err, len(entries))
+			}
+			for _, e := range decided {
+				if err := l.append(e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			l.close()
+
+			// The coordinator crashes in the middle of its next write.
+			file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.WriteString(tt.tail)
+			file.Close()
+
+			l, entries, err = openDecisionLog(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, decided) {
+				t.Fatalf("after the crash read %+v, want %+v", entries, decided)
+			}
+			next := entry{Kind: entryDecision, TxID: 3, Participants: []int{1, 2}}
+			if err := l.append(next); err != nil {
+				t.Fatal(err)
+			}
+			l.close()
+
+			entries, _, err = readEntries(path)
+			if err != nil {
+				t.Fatalf("after the restart: %v", err)
+			}
+			if want := append(decided, next); !reflect.DeepEqual(entries, want) {
+				t.Errorf("after the restart read %+v, want %+v", entries, want)
+			}
+		})
+	}
+}
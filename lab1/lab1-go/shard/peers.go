@@ -0,0 +1,79 @@
+package shard
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+var errTimeout = errors.New("rpc timed out")
+
+// peers keeps one net/rpc connection per shard and redials after a failure,
+// so a restarted shard becomes reachable again.
+type peers struct {
+	addrs   []string
+	timeout time.Duration
+
+	mu      sync.Mutex
+	clients map[int]*rpc.Client
+}
+
+func newPeers(addrs []string, timeout time.Duration) *peers {
+	return &peers{addrs: addrs, timeout: timeout, clients: make(map[int]*rpc.Client)}
+}
+
+func (p *peers) call(shard int, method string, args, reply any) error {
+	client, err := p.client(shard)
+	if err != nil {
+		return err
+	}
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	call := client.Go("Shard."+method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		var serverErr rpc.ServerError
+		if call.Error != nil && !errors.As(call.Error, &serverErr) {
+			p.drop(shard, client)
+		}
+		return call.Error
+	case <-timer.C:
+		p.drop(shard, client)
+		return errTimeout
+	}
+}
+
+func (p *peers) client(shard int) (*rpc.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if client, ok := p.clients[shard]; ok {
+		return client, nil
+	}
+	conn, err := net.DialTimeout("tcp", p.addrs[shard], p.timeout)
+	if err != nil {
+		return nil, err
+	}
+	client := rpc.NewClient(conn)
+	p.clients[shard] = client
+	return client, nil
+}
+
+func (p *peers) drop(shard int, client *rpc.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.clients[shard] == client {
+		delete(p.clients, shard)
+	}
+	client.Close()
+}
+
+func (p *peers) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for shard, client := range p.clients {
+		client.Close()
+		delete(p.clients, shard)
+	}
+}
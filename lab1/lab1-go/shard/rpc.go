@@ -0,0 +1,83 @@
+package shard
+
+import "lab1-go/bank"
+
+type TransferArgs struct {
+	From   int
+	To     int
+	Amount int
+}
+
+type TransferReply struct {
+	Status bank.Status
+}
+
+type PrepareArgs struct {
+	TxID    uint64
+	Account int
+	Delta   int
+}
+
+type Vote struct {
+	Yes    bool
+	Status bank.Status
+}
+
+type FinishArgs struct {
+	TxID   uint64
+	Commit bool
+}
+
+type StatusReply struct {
+	Total    int
+	Expected int
+	Pending  int
+}
+
+// Service is the net/rpc face of a Shard, registered as "Shard".
+type Service struct {
+	shard *Shard
+}
+
+func (svc *Service) OpenAccount(balance int, id *int) error {
+	var err error
+	*id, err = svc.shard.OpenAccount(balance)
+	return err
+}
+
+func (svc *Service) Balance(id int, balance *int) error {
+	var err error
+	*balance, err = svc.shard.Balance(id)
+	return err
+}
+
+// Transfer reports rejections through the status, not as an RPC error.
+func (svc *Service) Transfer(args TransferArgs, reply *TransferReply) error {
+	var err error
+	reply.Status, err = svc.shard.Transfer(args.From, args.To, args.Amount)
+	if reply.Status == bank.StatusPending {
+		return err
+	}
+	return nil
+}
+
+func (svc *Service) Prepare(args PrepareArgs, vote *Vote) error {
+	*vote = svc.shard.prepare(args.TxID, args.Account, args.Delta)
+	return nil
+}
+
+func (svc *Service) Finish(args FinishArgs, ack *bool) error {
+	svc.shard.finish(args.TxID, args.Commit)
+	*ack = true
+	return nil
+}
+
+func (svc *Service) Decision(tx uint64, answer *Outcome) error {
+	*answer = svc.shard.decisionFor(tx)
+	return nil
+}
+
+func (svc *Service) Status(_ int, reply *StatusReply) error {
+	*reply = svc.shard.Status()
+	return nil
+}
@@ -0,0 +1,257 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"lab1-go/bank"
+	"net"
+	"net/rpc"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	ID int
+	// Addrs holds the address of every shard, indexed by shard ID.
+	Addrs []string
+	// DataDir keeps the bank's transaction log and the two-phase commit log;
+	// without it the shard cannot survive a crash.
+	DataDir string
+	Bank    bank.Config
+
+	RPCTimeout time.Duration
+	// PrepareTimeout is how long a prepared participant waits for the
+	// decision before asking the coordinator for it.
+	PrepareTimeout time.Duration
+}
+
+// GlobalID maps an account of a shard to its cluster-wide ID.
+func GlobalID(shard, local, shards int) int {
+	return local*shards + shard
+}
+
+func ShardOf(id, shards int) int {
+	return id % shards
+}
+
+func localID(id, shards int) int {
+	return id / shards
+}
+
+// Shard owns a partition of the accounts in a local bank.Bank and takes part
+// in two-phase commits for transfers that cross shards.
+type Shard struct {
+	id     int
+	n      int
+	cfg    Config
+	bank   *bank.Bank
+	log    *decisionLog
+	peers  *peers
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	listener net.Listener
+
+	mu        sync.Mutex
+	nextTx    uint64
+	active    map[uint64]bool
+	decisions map[uint64]*decision
+	prepared  map[uint64]*participant
+	applied   map[string]bool
+}
+
+// decision is the coordinator's record of a cross-shard transfer.
+type decision struct {
+	commit       bool
+	participants []int
+	done         bool
+}
+
+// participant is one shard's leg of a cross-shard transfer.
+type participant struct {
+	account int
+	delta   int
+	since   time.Time
+	decided bool
+	commit  bool
+	// preparing is set while the withdrawal of the first phase runs.
+	preparing bool
+	settling  bool
+	settled   bool
+}
+
+func New(cfg Config) (*Shard, error) {
+	if cfg.RPCTimeout <= 0 {
+		cfg.RPCTimeout = time.Second
+	}
+	if cfg.PrepareTimeout <= 0 {
+		cfg.PrepareTimeout = 2 * time.Second
+	}
+	s := &Shard{
+		id:        cfg.ID,
+		n:         len(cfg.Addrs),
+		cfg:       cfg,
+		peers:     newPeers(cfg.Addrs, cfg.RPCTimeout),
+		nextTx:    1,
+		active:    make(map[uint64]bool),
+		decisions: make(map[uint64]*decision),
+		prepared:  make(map[uint64]*participant),
+		applied:   make(map[string]bool),
+	}
+
+	var entries []entry
+	if cfg.DataDir != "" {
+		cfg.Bank.LogPath = filepath.Join(cfg.DataDir, fmt.Sprintf("bank-%d.log", cfg.ID))
+		cfg.Bank.SyncLog = true
+		var err error
+		s.log, entries, err = openDecisionLog(filepath.Join(cfg.DataDir, fmt.Sprintf("2pc-%d.log", cfg.ID)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	b, err := bank.NewBank(cfg.Bank)
+	if err != nil {
+		s.log.close()
+		return nil, err
+	}
+	s.bank = b
+	if recovered := b.Recovered(); recovered != nil {
+		for ref := range recovered.Refs {
+			s.applied[ref] = true
+		}
+	}
+	s.replay(entries)
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.wg.Add(1)
+	go s.resolveLoop()
+	return s, nil
+}
+
+// replay rebuilds the two-phase commit state after a restart.
+func (s *Shard) replay(entries []entry) {
+	for _, e := range entries {
+		switch e.Kind {
+		case entryPrepared:
+			s.prepared[e.TxID] = &participant{account: e.Account, delta: e.Delta}
+		case entryOutcome:
+			if p := s.prepared[e.TxID]; p != nil {
+				p.decided, p.commit = true, e.Commit
+			}
+		case entryDecision:
+			s.decisions[e.TxID] = &decision{commit: e.Commit, participants: e.Participants}
+		case entryDone:
+			if d := s.decisions[e.TxID]; d != nil {
+				d.done = true
+			}
+		}
+		if int(e.TxID%uint64(s.n)) == s.id {
+			s.nextTx = max(s.nextTx, e.TxID/uint64(s.n)+1)
+		}
+	}
+
+	for tx, p := range s.prepared {
+		if p.decided {
+			p.settled = s.settledRef(tx, p)
+			continue
+		}
+		// a withdrawal that never happened means the vote was never yes
+		if p.delta < 0 && !s.applied[ref(tx, "prepare")] {
+			p.decided, p.commit, p.settled = true, false, true
+			s.log.append(entry{Kind: entryOutcome, TxID: tx, Commit: false})
+		}
+	}
+}
+
+func (s *Shard) settledRef(tx uint64, p *participant) bool {
+	switch {
+	case p.commit && p.delta > 0:
+		return s.applied[ref(tx, "commit")]
+	case !p.commit && p.delta < 0 && s.applied[ref(tx, "prepare")]:
+		return s.applied[ref(tx, "abort")]
+	}
+	return true
+}
+
+func ref(tx uint64, step string) string {
+	return fmt.Sprintf("2pc-%d-%s", tx, step)
+}
+
+// Serve accepts RPC connections on the shard's address until Close.
+func (s *Shard) Serve() error {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Shard", &Service{shard: s}); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", s.cfg.Addrs[s.id])
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go server.ServeConn(conn)
+	}
+}
+
+func (s *Shard) Close() {
+	s.cancel()
+	s.mu.Lock()
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	s.peers.close()
+	s.bank.Close()
+	s.log.close()
+}
+
+func (s *Shard) OpenAccount(balance int) (int, error) {
+	local, err := s.bank.OpenAccount(balance)
+	if err != nil {
+		return 0, err
+	}
+	return GlobalID(s.id, local, s.n), nil
+}
+
+func (s *Shard) Balance(id int) (int, error) {
+	if ShardOf(id, s.n) != s.id {
+		var balance int
+		err := s.peers.call(ShardOf(id, s.n), "Balance", id, &balance)
+		return balance, err
+	}
+	return s.bank.Balance(localID(id, s.n))
+}
+
+// Status reports the shard's consistent total and how many two-phase commits
+// it still has to resolve; totals across shards only add up once every shard
+// reports zero pending.
+func (s *Shard) Status() StatusReply {
+	snap := s.bank.Snapshot()
+	reply := StatusReply{Total: snap.Total, Expected: snap.Expected}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.prepared {
+		if !p.decided || !p.settled {
+			reply.Pending++
+		}
+	}
+	for _, d := range s.decisions {
+		if !d.done {
+			reply.Pending++
+		}
+	}
+	return reply
+}
@@ -0,0 +1,319 @@
+package shard
+
+import (
+	"lab1-go/bank"
+	"time"
+)
+
+// Outcome is a coordinator's answer to a participant asking for its decision.
+type Outcome string
+
+const (
+	OutcomePending Outcome = "pending"
+	OutcomeCommit  Outcome = "commit"
+	OutcomeAbort   Outcome = "abort"
+)
+
+// Transfer moves money between two accounts of the cluster. The shard owning
+// the source account coordinates; if the destination lives on another shard
+// the transfer runs as a two-phase commit.
+func (s *Shard) Transfer(from, to, amount int) (bank.Status, error) {
+	coordinator := ShardOf(from, s.n)
+	if coordinator != s.id {
+		var reply TransferReply
+		err := s.peers.call(coordinator, "Transfer", TransferArgs{From: from, To: to, Amount: amount}, &reply)
+		return reply.Status, err
+	}
+	if amount <= 0 || from == to {
+		return bank.StatusInvalid, bank.ErrInvalidAmount
+	}
+	if ShardOf(to, s.n) == s.id {
+		res, err := s.bank.Transfer(s.ctx, localID(from, s.n), localID(to, s.n), amount)
+		return res.Status, err
+	}
+	return s.coordinate(from, to, amount)
+}
+
+func (s *Shard) coordinate(from, to, amount int) (bank.Status, error) {
+	s.mu.Lock()
+	tx := s.nextTx*uint64(s.n) + uint64(s.id)
+	s.nextTx++
+	s.active[tx] = true
+	s.mu.Unlock()
+
+	// phase one: the source withdraws into escrow, the destination checks
+	// its account
+	local := s.prepare(tx, localID(from, s.n), -amount)
+	remote := Vote{Status: bank.StatusCancelled}
+	if local.Yes {
+		args := PrepareArgs{TxID: tx, Account: localID(to, s.n), Delta: amount}
+		if err := s.peers.call(ShardOf(to, s.n), "Prepare", args, &remote); err != nil {
+			remote = Vote{Status: bank.StatusCancelled}
+		}
+	}
+	commit := local.Yes && remote.Yes
+	participants := []int{s.id, ShardOf(to, s.n)}
+
+	if err := s.decide(tx, commit, participants); err != nil {
+		// without a durable decision the transfer stays undecided and
+		// resolves to an abort when a participant asks
+		return bank.StatusFailed, err
+	}
+
+	// phase two
+	s.deliver(tx)
+
+	switch {
+	case commit:
+		return bank.StatusCommitted, nil
+	case !local.Yes:
+		return local.Status, local.Status.Err()
+	default:
+		return remote.Status, remote.Status.Err()
+	}
+}
+
+// decide logs the decision, the commit point of the transfer, and retires it
+// from the active set.
+func (s *Shard) decide(tx uint64, commit bool, participants []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.active, tx)
+	if err := s.log.append(entry{Kind: entryDecision, TxID: tx, Commit: commit, Participants: participants}); err != nil {
+		return err
+	}
+	s.decisions[tx] = &decision{commit: commit, participants: participants}
+	return nil
+}
+
+// deliver sends the decision to every participant. Participants that cannot
+// be reached are retried by the resolve loop.
+func (s *Shard) deliver(tx uint64) {
+	s.mu.Lock()
+	d := s.decisions[tx]
+	if d == nil || d.done {
+		s.mu.Unlock()
+		return
+	}
+	participants, commit := d.participants, d.commit
+	s.mu.Unlock()
+
+	for _, shard := range participants {
+		if shard == s.id {
+			s.finish(tx, commit)
+			continue
+		}
+		var ack bool
+		if err := s.peers.call(shard, "Finish", FinishArgs{TxID: tx, Commit: commit}, &ack); err != nil || !ack {
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log.append(entry{Kind: entryDone, TxID: tx}) == nil {
+		d.done = true
+	}
+}
+
+// decisionFor answers a participant asking about tx. A transaction this
+// coordinator has no decision for and is not running any more, because it
+// crashed before deciding, is aborted for good.
+func (s *Shard) decisionFor(tx uint64) Outcome {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.decisions[tx]; d != nil {
+		if d.commit {
+			return OutcomeCommit
+		}
+		return OutcomeAbort
+	}
+	if s.active[tx] {
+		return OutcomePending
+	}
+	if s.log.append(entry{Kind: entryDecision, TxID: tx, Commit: false}) != nil {
+		return OutcomePending
+	}
+	s.decisions[tx] = &decision{commit: false, done: true}
+	return OutcomeAbort
+}
+
+// prepare is a participant's first phase: it logs its intent, then a debit
+// withdraws the money so it cannot be spent twice and a credit only checks
+// that the account exists.
+func (s *Shard) prepare(tx uint64, account, delta int) Vote {
+	s.mu.Lock()
+	if p := s.prepared[tx]; p != nil {
+		s.mu.Unlock()
+		if p.decided && !p.commit {
+			return Vote{Status: bank.StatusCancelled}
+		}
+		return Vote{Yes: true}
+	}
+	if err := s.log.append(entry{Kind: entryPrepared, TxID: tx, Account: account, Delta: delta}); err != nil {
+		s.mu.Unlock()
+		return Vote{Status: bank.StatusFailed}
+	}
+	p := &participant{account: account, delta: delta, since: time.Now(), preparing: true}
+	s.prepared[tx] = p
+	s.mu.Unlock()
+
+	var status bank.Status
+	var err error
+	if delta < 0 {
+		var res bank.MultiResult
+		res, err = s.bank.Withdraw(s.ctx, account, -delta, ref(tx, "prepare"))
+		status = res.Status
+	} else if _, err = s.bank.Balance(account); err != nil {
+		status = bank.StatusUnknownAccount
+	}
+
+	s.mu.Lock()
+	if err == nil && delta < 0 {
+		s.applied[ref(tx, "prepare")] = true
+	}
+	p.preparing = false
+	aborted := p.decided && !p.commit
+	s.mu.Unlock()
+
+	if err != nil || aborted {
+		// also settles an abort that arrived while withdrawing
+		s.finish(tx, false)
+		if err == nil {
+			status = bank.StatusCancelled
+		}
+		return Vote{Status: status}
+	}
+	return Vote{Yes: true}
+}
+
+// finish records the participant's Outcome and settles it: a committed credit
+// is deposited, an aborted debit is refunded.
+func (s *Shard) finish(tx uint64, commit bool) {
+	s.mu.Lock()
+	p := s.prepared[tx]
+	if p == nil {
+		s.mu.Unlock()
+		return
+	}
+	if !p.decided {
+		if s.log.append(entry{Kind: entryOutcome, TxID: tx, Commit: commit}) != nil {
+			s.mu.Unlock()
+			return
+		}
+		p.decided, p.commit = true, commit
+		p.settled = !(commit && p.delta > 0) && !(!commit && p.delta < 0)
+	}
+	s.mu.Unlock()
+	s.settle(tx, p)
+}
+
+func (s *Shard) settle(tx uint64, p *participant) {
+	s.mu.Lock()
+	if p.settled || p.settling || p.preparing {
+		s.mu.Unlock()
+		return
+	}
+	p.settling = true
+	s.mu.Unlock()
+
+	var step string
+	if p.commit {
+		step = "commit"
+	} else {
+		step = "abort"
+	}
+	done := s.isApplied(ref(tx, step))
+	// an aborted debit whose withdrawal failed has nothing to refund
+	if !done && !p.commit && !s.isApplied(ref(tx, "prepare")) {
+		done = true
+	}
+	if !done {
+		amount := p.delta
+		if amount < 0 {
+			amount = -amount
+		}
+		if _, err := s.bank.Deposit(s.ctx, p.account, amount, ref(tx, step)); err == nil {
+			s.markApplied(ref(tx, step))
+			done = true
+		}
+	}
+
+	s.mu.Lock()
+	p.settling = false
+	p.settled = done
+	s.mu.Unlock()
+}
+
+func (s *Shard) markApplied(ref string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.applied[ref] = true
+}
+
+func (s *Shard) isApplied(ref string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.applied[ref]
+}
+
+// resolveLoop finishes what crashes and timeouts left behind: participants
+// prepared for too long ask their coordinator, undelivered decisions are
+// resent and unsettled outcomes retried.
+func (s *Shard) resolveLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.cfg.PrepareTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.resolve()
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Shard) resolve() {
+	type pending struct {
+		tx uint64
+		p  *participant
+	}
+	var waiting, unsettled []pending
+	var undelivered []uint64
+
+	s.mu.Lock()
+	for tx, p := range s.prepared {
+		switch {
+		case !p.decided && time.Since(p.since) >= s.cfg.PrepareTimeout:
+			waiting = append(waiting, pending{tx, p})
+		case p.decided && !p.settled:
+			unsettled = append(unsettled, pending{tx, p})
+		}
+	}
+	for tx, d := range s.decisions {
+		if !d.done {
+			undelivered = append(undelivered, tx)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, w := range waiting {
+		coordinator := int(w.tx % uint64(s.n))
+		answer := OutcomePending
+		if coordinator == s.id {
+			answer = s.decisionFor(w.tx)
+		} else if err := s.peers.call(coordinator, "Decision", w.tx, &answer); err != nil {
+			continue
+		}
+		if answer != OutcomePending {
+			s.finish(w.tx, answer == OutcomeCommit)
+		}
+	}
+	for _, u := range unsettled {
+		s.settle(u.tx, u.p)
+	}
+	for _, tx := range undelivered {
+		s.deliver(tx)
+	}
+}
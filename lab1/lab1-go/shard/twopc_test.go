@@ -0,0 +1,250 @@
+package shard
+
+import (
+	"lab1-go/bank"
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	testRPCTimeout     = 200 * time.Millisecond
+	testPrepareTimeout = 200 * time.Millisecond
+)
+
+// loopbackAddrs reserves n free ports on the loopback interface.
+func loopbackAddrs(t *testing.T, n int) []string {
+	t.Helper()
+	addrs := make([]string, n)
+	for i := range addrs {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs[i] = l.Addr().String()
+		l.Close()
+	}
+	return addrs
+}
+
+// startShard runs shard id of the cluster at addrs until it is closed; with
+// a data directory it survives being closed and started again.
+func startShard(t *testing.T, id int, addrs []string, dataDir string) *Shard {
+	t.Helper()
+	s, err := New(Config{
+		ID:             id,
+		Addrs:          addrs,
+		DataDir:        dataDir,
+		RPCTimeout:     testRPCTimeout,
+		PrepareTimeout: testPrepareTimeout,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.DialTimeout("tcp", addrs[id], testRPCTimeout)
+		if err == nil {
+			conn.Close()
+			return s
+		}
+		if time.Now().After(deadline) {
+			s.Close()
+			t.Fatalf("shard %d is not listening: %v", id, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func openAccount(t *testing.T, s *Shard, balance int) int {
+	t.Helper()
+	id, err := s.OpenAccount(balance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// settled waits until none of the shards has a two-phase commit left to
+// resolve and then checks the balances.
+func settled(t *testing.T, shards []*Shard, want map[int]int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		pending := 0
+		for _, s := range shards {
+			pending += s.Status().Pending
+		}
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d two-phase commits still pending", pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for id, balance := range want {
+		if got, err := shards[0].Balance(id); err != nil || got != balance {
+			t.Errorf("account %d: balance %d, %v; want %d", id, got, err, balance)
+		}
+	}
+}
+
+func TestCrossShardCommit(t *testing.T) {
+	addrs := loopbackAddrs(t, 2)
+	s0, s1 := startShard(t, 0, addrs, ""), startShard(t, 1, addrs, "")
+	defer s0.Close()
+	defer s1.Close()
+	a, b := openAccount(t, s0, 100), openAccount(t, s1, 0)
+
+	if status, err := s0.Transfer(a, b, 30); status != bank.StatusCommitted || err != nil {
+		t.Fatalf("transfer: %v, %v", status, err)
+	}
+	// Shard 1 is not the coordinator, so it hands the transfer to shard 0.
+	if status, err := s1.Transfer(a, b, 200); status != bank.StatusInsufficientFunds {
+		t.Fatalf("overdraft: %v, %v", status, err)
+	}
+	settled(t, []*Shard{s0, s1}, map[int]int{a: 70, b: 30})
+}
+
+func TestPrepareTimeoutAborts(t *testing.T) {
+	addrs := loopbackAddrs(t, 2)
+	// Shard 1 accepts connections and never answers.
+	hung, err := net.Listen("tcp", addrs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hung.Close()
+	go func() {
+		for {
+			if _, err := hung.Accept(); err != nil {
+				return
+			}
+		}
+	}()
+
+	s0 := startShard(t, 0, addrs, "")
+	defer s0.Close()
+	a := openAccount(t, s0, 100)
+	b := GlobalID(1, 0, 2)
+
+	status, err := s0.Transfer(a, b, 30)
+	if status != bank.StatusCancelled || err == nil {
+		t.Fatalf("transfer to a hung shard: %v, %v", status, err)
+	}
+	// The escrowed withdrawal is refunded even though the decision cannot
+	// be delivered to shard 1.
+	if got, _ := s0.Balance(a); got != 100 {
+		t.Errorf("balance %d after the abort, want 100", got)
+	}
+	if snap := s0.bank.Snapshot(); snap.Total != snap.Expected {
+		t.Errorf("total %d, expected %d", snap.Total, snap.Expected)
+	}
+}
+
+// TestCoordinatorRestart crashes the coordinator after both participants
+// prepared, once after it logged a commit and once before it decided.
+func TestCoordinatorRestart(t *testing.T) {
+	tests := []struct {
+		name   string
+		decide bool
+		want   int
+	}{
+		{name: "logged commit", decide: true, want: 40},
+		{name: "no decision", decide: false, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs := loopbackAddrs(t, 2)
+			dir0, dir1 := t.TempDir(), t.TempDir()
+			s0, s1 := startShard(t, 0, addrs, dir0), startShard(t, 1, addrs, dir1)
+			defer s1.Close()
+			a, b := openAccount(t, s0, 100), openAccount(t, s1, 0)
+
+			// Phase one of a transfer coordinated by shard 0, by hand.
+			s0.mu.Lock()
+			tx := s0.nextTx*2 + 0
+			s0.nextTx++
+			s0.active[tx] = true
+			s0.mu.Unlock()
+			if vote := s0.prepare(tx, localID(a, 2), -40); !vote.Yes {
+				t.Fatalf("source voted %+v", vote)
+			}
+			var vote Vote
+			if err := s0.peers.call(1, "Prepare", PrepareArgs{TxID: tx, Account: localID(b, 2), Delta: 40}, &vote); err != nil || !vote.Yes {
+				t.Fatalf("destination voted %+v, %v", vote, err)
+			}
+			if tt.decide {
+				if err := s0.decide(tx, true, []int{0, 1}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s0.Close()
+
+			s0 = startShard(t, 0, addrs, dir0)
+			defer s0.Close()
+			settled(t, []*Shard{s0, s1}, map[int]int{a: 100 - tt.want, b: tt.want})
+
+			// The coordinator keeps answering the same way.
+			want := OutcomeAbort
+			if tt.decide {
+				want = OutcomeCommit
+			}
+			if got := s0.decisionFor(tx); got != want {
+				t.Errorf("decision %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDuplicatePrepareAndFinish(t *testing.T) {
+	addrs := loopbackAddrs(t, 2)
+	s0, s1 := startShard(t, 0, addrs, ""), startShard(t, 1, addrs, "")
+	defer s0.Close()
+	defer s1.Close()
+	a, b := openAccount(t, s0, 100), openAccount(t, s1, 0)
+
+	// A coordinator retrying every call of both phases over RPC.
+	client := newPeers(addrs, testRPCTimeout)
+	defer client.close()
+	const tx = 2
+	// Keep the participants from resolving the transfer on their own.
+	s0.mu.Lock()
+	s0.active[tx] = true
+	s0.mu.Unlock()
+	prepares := []struct {
+		shard int
+		args  PrepareArgs
+	}{
+		{0, PrepareArgs{TxID: tx, Account: localID(a, 2), Delta: -40}},
+		{1, PrepareArgs{TxID: tx, Account: localID(b, 2), Delta: 40}},
+	}
+	for range 2 {
+		for _, p := range prepares {
+			var vote Vote
+			if err := client.call(p.shard, "Prepare", p.args, &vote); err != nil || !vote.Yes {
+				t.Fatalf("prepare on shard %d: %+v, %v", p.shard, vote, err)
+			}
+		}
+	}
+	if got, _ := s0.Balance(a); got != 60 {
+		t.Errorf("balance %d after two prepares, want 60", got)
+	}
+	for range 2 {
+		for shard := range addrs {
+			var ack bool
+			if err := client.call(shard, "Finish", FinishArgs{TxID: tx, Commit: true}, &ack); err != nil || !ack {
+				t.Fatalf("finish on shard %d: %v, %v", shard, ack, err)
+			}
+		}
+	}
+	settled(t, []*Shard{s0, s1}, map[int]int{a: 60, b: 40})
+
+	// A prepare repeated after the commit does not withdraw again.
+	var vote Vote
+	if err := client.call(0, "Prepare", prepares[0].args, &vote); err != nil || !vote.Yes {
+		t.Fatalf("late prepare: %+v, %v", vote, err)
+	}
+	settled(t, []*Shard{s0, s1}, map[int]int{a: 60, b: 40})
+}
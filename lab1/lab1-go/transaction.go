@@ -1,8 +0,0 @@
-package main
-
-type Transaction struct {
-	From          int
-	To            int
-	Amount        int
-	otherTxDoneCh chan bool
-}
@@ -0,0 +1,81 @@
+package workload
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Write stores the workload as JSON lines: a header with the seed and the
+// opening balances, then one operation per line.
+func (w *Workload) Write(out io.Writer) error {
+	buf := bufio.NewWriter(out)
+	enc := json.NewEncoder(buf)
+	if err := enc.Encode(w); err != nil {
+		return err
+	}
+	for _, op := range w.Ops {
+		if err := enc.Encode(op); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+func (w *Workload) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := w.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func Read(in io.Reader) (*Workload, error) {
+	dec := json.NewDecoder(bufio.NewReader(in))
+	var w Workload
+	if err := dec.Decode(&w); err != nil {
+		return nil, fmt.Errorf("workload header: %v", err)
+	}
+	for {
+		var op Op
+		err := dec.Decode(&op)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("workload op %d: %v", len(w.Ops)+1, err)
+		}
+		w.Ops = append(w.Ops, op)
+	}
+	return &w, w.validate()
+}
+
+func Load(path string) (*Workload, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+func (w *Workload) validate() error {
+	n := len(w.Balances)
+	valid := func(acc int) bool { return acc >= 0 && acc < n }
+	for i, op := range w.Ops {
+		ok := valid(op.From) && valid(op.To)
+		for _, leg := range op.Legs {
+			ok = ok && valid(leg.Account)
+		}
+		if !ok {
+			return fmt.Errorf("workload op %d refers to an account outside 0..%d", i+1, n-1)
+		}
+	}
+	return nil
+}
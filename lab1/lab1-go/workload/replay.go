@@ -0,0 +1,109 @@
+package workload
+
+import (
+	"context"
+	"lab1-go/bank"
+	"sync"
+	"time"
+)
+
+// Outcome is the result of one replayed operation.
+type Outcome struct {
+	Status  bank.Status
+	Latency time.Duration
+}
+
+// Target is what a workload is replayed against: a *bank.Bank or a wrapper
+// that records the calls.
+type Target interface {
+	Transfer(ctx context.Context, from, to, amount int) (bank.Result, error)
+	TransferMulti(ctx context.Context, legs []bank.Leg) (bank.MultiResult, error)
+}
+
+// OpenAccounts opens one account per workload balance and returns their IDs
+// in workload order.
+func (w *Workload) OpenAccounts(b *bank.Bank) ([]int, error) {
+	ids := make([]int, len(w.Balances))
+	for i, balance := range w.Balances {
+		id, err := b.OpenAccount(balance)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// Replay submits every operation to b, mapping workload accounts through
+// ids. Operations with arrival times are started at their offset from the
+// beginning of the replay, each on its own goroutine; otherwise clients
+// goroutines submit them back to back in workload order.
+func (w *Workload) Replay(ctx context.Context, b Target, ids []int, clients int) []Outcome {
+	outcomes := make([]Outcome, len(w.Ops))
+	var wg sync.WaitGroup
+
+	if w.Timed() {
+		start := time.Now()
+		for i := range w.Ops {
+			if wait := w.Ops[i].At - time.Since(start); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					wg.Wait()
+					return outcomes
+				}
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				outcomes[i] = w.run(ctx, b, ids, i)
+			}()
+		}
+		wg.Wait()
+		return outcomes
+	}
+
+	next := make(chan int)
+	for c := 0; c < max(1, clients); c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				outcomes[i] = w.run(ctx, b, ids, i)
+			}
+		}()
+	}
+	for i := range w.Ops {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return outcomes
+}
+
+// Timed reports whether the operations carry arrival times.
+func (w *Workload) Timed() bool {
+	for _, op := range w.Ops {
+		if op.At > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Workload) run(ctx context.Context, b Target, ids []int, i int) Outcome {
+	op := w.Ops[i]
+	begin := time.Now()
+	if op.Legs != nil {
+		legs := make([]bank.Leg, len(op.Legs))
+		for j, leg := range op.Legs {
+			legs[j] = bank.Leg{Account: ids[leg.Account], Amount: leg.Amount}
+		}
+		res, _ := b.TransferMulti(ctx, legs)
+		return Outcome{Status: res.Status, Latency: time.Since(begin)}
+	}
+	res, _ := b.Transfer(ctx, ids[op.From], ids[op.To], op.Amount)
+	return Outcome{Status: res.Status, Latency: time.Since(begin)}
+}
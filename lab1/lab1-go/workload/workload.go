@@ -0,0 +1,183 @@
+package workload
+
+import (
+	"fmt"
+	"lab1-go/bank"
+	"math"
+	"math/rand"
+	"time"
+)
+
+type Selection string
+
+const (
+	SelectUniform Selection = "uniform"
+	// SelectZipf picks account i with probability proportional to 1/(i+1)^s.
+	SelectZipf Selection = "zipf"
+	// SelectHotspot sends HotProbability of the picks to the first
+	// HotFraction of the accounts.
+	SelectHotspot Selection = "hotspot"
+)
+
+type AmountDist string
+
+const (
+	AmountUniform     AmountDist = "uniform"
+	AmountExponential AmountDist = "exponential"
+	AmountFixed       AmountDist = "fixed"
+)
+
+type Config struct {
+	Seed       int64
+	Accounts   int
+	Transfers  int
+	MaxBalance int
+
+	Selection      Selection
+	ZipfS          float64
+	HotFraction    float64
+	HotProbability float64
+
+	Amounts    AmountDist
+	MaxAmount  int
+	MeanAmount float64
+
+	// Rate is the mean number of arrivals per second (Poisson); zero means
+	// the operations carry no arrival time and run back to back.
+	Rate float64
+	// PayoutFraction of the operations are multi-leg batch payouts.
+	PayoutFraction float64
+}
+
+// Op is one operation of a workload. Accounts are indexes into
+// Workload.Balances, not bank account IDs.
+type Op struct {
+	At     time.Duration `json:"at,omitempty"`
+	From   int           `json:"from"`
+	To     int           `json:"to"`
+	Amount int           `json:"amount"`
+	// Legs is set for multi-leg payouts instead of From/To/Amount.
+	Legs []bank.Leg `json:"legs,omitempty"`
+}
+
+type Workload struct {
+	Seed     int64 `json:"seed"`
+	Balances []int `json:"balances"`
+	Ops      []Op  `json:"-"`
+}
+
+type generator struct {
+	cfg  Config
+	rng  *rand.Rand
+	zipf *rand.Zipf
+	// perm maps a popularity rank to an account so the hot accounts are not
+	// always the first ones opened.
+	perm []int
+}
+
+// Generate builds a workload; the same Config always yields the same
+// workload.
+func Generate(cfg Config) (*Workload, error) {
+	if cfg.Accounts < 2 {
+		return nil, fmt.Errorf("need at least two accounts, got %d", cfg.Accounts)
+	}
+	if cfg.MaxAmount <= 0 || cfg.MaxBalance <= 0 {
+		return nil, fmt.Errorf("max amount and max balance must be positive")
+	}
+	g := &generator{cfg: cfg, rng: rand.New(rand.NewSource(cfg.Seed))}
+	g.perm = g.rng.Perm(cfg.Accounts)
+
+	switch cfg.Selection {
+	case "", SelectUniform:
+	case SelectZipf:
+		if cfg.ZipfS <= 1 {
+			return nil, fmt.Errorf("zipf exponent must be > 1, got %v", cfg.ZipfS)
+		}
+		g.zipf = rand.NewZipf(g.rng, cfg.ZipfS, 1, uint64(cfg.Accounts-1))
+	case SelectHotspot:
+		if cfg.HotFraction <= 0 || cfg.HotFraction > 1 || cfg.HotProbability < 0 || cfg.HotProbability > 1 {
+			return nil, fmt.Errorf("hotspot fraction and probability must be in (0, 1]")
+		}
+	default:
+		return nil, fmt.Errorf("unknown account selection %q", cfg.Selection)
+	}
+	switch cfg.Amounts {
+	case "", AmountUniform, AmountFixed:
+	case AmountExponential:
+		if cfg.MeanAmount <= 0 {
+			return nil, fmt.Errorf("exponential amounts need a positive mean")
+		}
+	default:
+		return nil, fmt.Errorf("unknown amount distribution %q", cfg.Amounts)
+	}
+
+	w := &Workload{Seed: cfg.Seed, Balances: make([]int, cfg.Accounts), Ops: make([]Op, cfg.Transfers)}
+	for i := range w.Balances {
+		w.Balances[i] = g.rng.Intn(cfg.MaxBalance)
+	}
+	var at time.Duration
+	for i := range w.Ops {
+		if cfg.Rate > 0 {
+			at += time.Duration(g.rng.ExpFloat64() / cfg.Rate * float64(time.Second))
+		}
+		if cfg.Accounts > 2 && g.rng.Float64() < cfg.PayoutFraction {
+			w.Ops[i] = Op{At: at, Legs: g.payout()}
+			continue
+		}
+		from := g.account()
+		to := g.account()
+		for to == from {
+			to = g.account()
+		}
+		w.Ops[i] = Op{At: at, From: from, To: to, Amount: g.amount()}
+	}
+	return w, nil
+}
+
+func (g *generator) account() int {
+	switch g.cfg.Selection {
+	case SelectZipf:
+		return g.perm[g.zipf.Uint64()]
+	case SelectHotspot:
+		hot := max(1, int(math.Ceil(g.cfg.HotFraction*float64(g.cfg.Accounts))))
+		if hot < g.cfg.Accounts && g.rng.Float64() >= g.cfg.HotProbability {
+			return g.perm[hot+g.rng.Intn(g.cfg.Accounts-hot)]
+		}
+		return g.perm[g.rng.Intn(hot)]
+	}
+	return g.rng.Intn(g.cfg.Accounts)
+}
+
+func (g *generator) amount() int {
+	switch g.cfg.Amounts {
+	case AmountFixed:
+		return g.cfg.MaxAmount
+	case AmountExponential:
+		return min(g.cfg.MaxAmount, int(g.rng.ExpFloat64()*g.cfg.MeanAmount))
+	}
+	return g.rng.Intn(g.cfg.MaxAmount)
+}
+
+// payout debits one account and credits between two and four others.
+func (g *generator) payout() []bank.Leg {
+	payer := g.account()
+	payees := 2 + g.rng.Intn(min(3, g.cfg.Accounts-2))
+	seen := map[int]bool{payer: true}
+	legs := make([]bank.Leg, 0, payees+1)
+	paid := 0
+	for len(legs) < payees {
+		acc := g.account()
+		if seen[acc] {
+			// skewed selection keeps returning the hot accounts
+			acc = g.rng.Intn(g.cfg.Accounts)
+			if seen[acc] {
+				continue
+			}
+		}
+		seen[acc] = true
+		amount := 1 + g.amount()/payees
+		legs = append(legs, bank.Leg{Account: acc, Amount: amount})
+		paid += amount
+	}
+	return append(legs, bank.Leg{Account: payer, Amount: -paid})
+}
@@ -0,0 +1,189 @@
+package workload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"lab1-go/bank"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func testConfig(selection Selection) Config {
+	return Config{
+		Seed:           7,
+		Accounts:       100,
+		Transfers:      10_000,
+		MaxBalance:     1000,
+		Selection:      selection,
+		ZipfS:          1.5,
+		HotFraction:    0.1,
+		HotProbability: 0.9,
+		Amounts:        AmountExponential,
+		MaxAmount:      500,
+		MeanAmount:     50,
+		Rate:           1000,
+		PayoutFraction: 0.1,
+	}
+}
+
+func TestGenerateSeeded(t *testing.T) {
+	for _, selection := range []Selection{SelectUniform, SelectZipf, SelectHotspot} {
+		cfg := testConfig(selection)
+		w1, err := Generate(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w2, _ := Generate(cfg)
+		if !reflect.DeepEqual(w1, w2) {
+			t.Errorf("%s: the same seed gave different workloads", selection)
+		}
+		cfg.Seed++
+		w3, _ := Generate(cfg)
+		if reflect.DeepEqual(w1.Ops, w3.Ops) {
+			t.Errorf("%s: different seeds gave the same operations", selection)
+		}
+	}
+}
+
+// hotShare is the share of the account picks that went to the tenth of the
+// accounts picked most.
+func hotShare(w *Workload) float64 {
+	counts := make([]int, len(w.Balances))
+	picks := 0
+	for _, op := range w.Ops {
+		if op.Legs != nil {
+			continue
+		}
+		counts[op.From]++
+		counts[op.To]++
+		picks += 2
+	}
+	slices.Sort(counts)
+	slices.Reverse(counts)
+	hot := 0
+	for _, c := range counts[:len(counts)/10] {
+		hot += c
+	}
+	return float64(hot) / float64(picks)
+}
+
+func TestSkewedSelection(t *testing.T) {
+	tests := []struct {
+		selection Selection
+		min, max  float64
+	}{
+		{SelectUniform, 0, 0.2},
+		{SelectZipf, 0.5, 1},
+		{SelectHotspot, 0.8, 1},
+	}
+	for _, tt := range tests {
+		w, err := Generate(testConfig(tt.selection))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if share := hotShare(w); share < tt.min || share > tt.max {
+			t.Errorf("%s: the hottest tenth of the accounts got %.2f of the picks, want %.2f to %.2f", tt.selection, share, tt.min, tt.max)
+		}
+	}
+}
+
+func TestGenerateInvalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{Accounts: 1, MaxAmount: 1, MaxBalance: 1},
+		{Accounts: 2, MaxAmount: 0, MaxBalance: 1},
+		{Accounts: 2, MaxAmount: 1, MaxBalance: 1, Selection: SelectZipf, ZipfS: 1},
+		{Accounts: 2, MaxAmount: 1, MaxBalance: 1, Selection: SelectHotspot},
+		{Accounts: 2, MaxAmount: 1, MaxBalance: 1, Selection: "round robin"},
+		{Accounts: 2, MaxAmount: 1, MaxBalance: 1, Amounts: AmountExponential},
+	} {
+		if _, err := Generate(cfg); err == nil {
+			t.Errorf("%+v generated a workload", cfg)
+		}
+	}
+}
+
+// recorder is a Target that remembers every call instead of moving money.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) Transfer(ctx context.Context, from, to, amount int) (bank.Result, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, fmt.Sprint("transfer", from, to, amount))
+	return bank.Result{Status: bank.StatusCommitted}, nil
+}
+
+func (r *recorder) TransferMulti(ctx context.Context, legs []bank.Leg) (bank.MultiResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, fmt.Sprint("multi", legs))
+	return bank.MultiResult{Status: bank.StatusCommitted}, nil
+}
+
+func TestWriteReadReplay(t *testing.T) {
+	cfg := testConfig(SelectZipf)
+	cfg.Transfers, cfg.Rate = 500, 0
+	w, err := Generate(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "workload.jsonl")
+	if err := w.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, w) {
+		t.Fatal("the workload read back differs from the one written")
+	}
+
+	ids := make([]int, len(w.Balances))
+	for i := range ids {
+		ids[i] = 1000 + i
+	}
+	var original, replayed recorder
+	w.Replay(context.Background(), &original, ids, 1)
+	read.Replay(context.Background(), &replayed, ids, 1)
+	if len(original.calls) != len(w.Ops) || !slices.Equal(original.calls, replayed.calls) {
+		t.Errorf("replaying the file made %d calls, the original %d, or in another order", len(replayed.calls), len(original.calls))
+	}
+
+	// Against a bank, one client at a time, both end with the same outcomes.
+	var statuses [2][]bank.Status
+	for i, w := range []*Workload{w, read} {
+		b, err := bank.NewBank(bank.Config{Engine: bank.EngineLock})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, err := w.OpenAccounts(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, outcome := range w.Replay(context.Background(), b, ids, 1) {
+			statuses[i] = append(statuses[i], outcome.Status)
+		}
+		b.Close()
+	}
+	if !slices.Equal(statuses[0], statuses[1]) {
+		t.Error("the replayed file ended with other outcomes than the original")
+	}
+}
+
+func TestReadRejectsUnknownAccount(t *testing.T) {
+	var buf bytes.Buffer
+	w := &Workload{Balances: []int{10, 20}, Ops: []Op{{From: 0, To: 2, Amount: 5}}}
+	if err := w.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(&buf); err == nil {
+		t.Error("read an operation on account 2 of 2")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"lab2-go/reduce"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+)
+
+var benchConsumers = []int{1, 2, 4, 8}
+
+// runBenchmark times the scalar product of two random vectors of length n:
+// first every transport and capacity at the given chunk size, then every
+// transport with one product per chunk, then the given transport and
+// capacity at growing chunk sizes.
+func runBenchmark(n int, transport Transport, capacity, chunk int) {
+	rng := rand.New(rand.NewSource(1))
+	vector1 := make([]int, n)
+	vector2 := make([]int, n)
+	expected := 0
+	for i := range vector1 {
+		vector1[i], vector2[i] = rng.Intn(201)-100, rng.Intn(201)-100
+		expected += vector1[i] * vector2[i]
+	}
+	run := func(transport Transport, capacity, chunk, consumers int) (time.Duration, bool) {
+		queue, err := newQueue[int](transport, capacity, consumers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		start := time.Now()
+		sums, err := runScalarProduct(context.Background(), queue, vector1, vector2, chunk, consumers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		elapsed := time.Since(start)
+		total := 0
+		for _, sum := range sums {
+			total += sum
+		}
+		return elapsed, total == expected
+	}
+
+	fmt.Printf("Benchmark: vectors of %d elements, chunks of %d\n\n", n, chunk)
+	fmt.Printf("%-6s %9s %10s %10s %14s %6s\n", "buffer", "capacity", "consumers", "time", "products/s", "ok")
+	for _, transport := range Transports {
+		for _, capacity := range []int{0, 1, 16, 256, 4096} {
+			if transport == TransportCond && capacity == 0 || transport == TransportRing && capacity < 2 {
+				continue
+			}
+			for _, consumers := range benchConsumers {
+				elapsed, ok := run(transport, capacity, chunk, consumers)
+				fmt.Printf("%-6s %9d %10d %10v %14.0f %6v\n", transport, capacity, consumers,
+					elapsed.Round(time.Microsecond), float64(n)/elapsed.Seconds(), ok)
+			}
+		}
+	}
+
+	// Chunks hide most of the synchronization; one product per chunk is
+	// where the transports differ.
+	fmt.Printf("\nPer-element transport: chunks of 1, capacity 256\n\n")
+	fmt.Printf("%-6s %10s %10s %14s %6s\n", "buffer", "consumers", "time", "products/s", "ok")
+	for _, transport := range Transports {
+		for _, consumers := range benchConsumers {
+			elapsed, ok := run(transport, 256, 1, consumers)
+			fmt.Printf("%-6s %10d %10v %14.0f %6v\n", transport, consumers,
+				elapsed.Round(time.Microsecond), float64(n)/elapsed.Seconds(), ok)
+		}
+	}
+
+	benchFloatDot(n)
+
+	fmt.Printf("\nChunk scaling: %s buffer, capacity %d; speedup is against chunks of 1 with one consumer\n\n", transport, capacity)
+	fmt.Printf("%-7s %10s %10s %14s %8s %6s\n", "chunk", "consumers", "time", "products/s", "speedup", "ok")
+	var base time.Duration
+	for _, chunk := range []int{1, 16, 256, 4096, 65536} {
+		for _, consumers := range benchConsumers {
+			elapsed, ok := run(transport, capacity, chunk, consumers)
+			if base == 0 {
+				base = elapsed
+			}
+			fmt.Printf("%-7d %10d %10v %14.0f %7.1fx %6v\n", chunk, consumers,
+				elapsed.Round(time.Microsecond), float64(n)/elapsed.Seconds(), float64(base)/float64(elapsed), ok)
+		}
+	}
+}
+
+// benchFloatDot shows the float dot product drifting with the number of
+// workers unless the reduction tree is fixed.
+func benchFloatDot(n int) {
+	rng := rand.New(rand.NewSource(1))
+	x := make([]float64, n)
+	y := make([]float64, n)
+	for i := range x {
+		x[i], y[i] = rng.NormFloat64()*1e6, rng.NormFloat64()
+	}
+
+	fmt.Printf("\nFloat dot product of %d elements: bit-identical to the single worker result?\n\n", n)
+	fmt.Printf("%-14s %8s %25s %10s %10s\n", "reduction", "workers", "result", "time", "identical")
+	for _, deterministic := range []bool{false, true} {
+		name := "per worker"
+		if deterministic {
+			name = "fixed tree"
+		}
+		var first float64
+		for _, workers := range benchConsumers {
+			start := time.Now()
+			dot, _ := reduce.Dot(x, y, reduce.Options{Workers: workers, Deterministic: deterministic})
+			elapsed := time.Since(start)
+			if workers == benchConsumers[0] {
+				first = dot
+			}
+			fmt.Printf("%-14s %8d %25.17g %10v %10v\n", name, workers, dot,
+				elapsed.Round(time.Microsecond), math.Float64bits(dot) == math.Float64bits(first))
+		}
+	}
+}
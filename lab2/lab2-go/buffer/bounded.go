@@ -0,0 +1,140 @@
+package buffer
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// BoundedBuffer is the Go counterpart of the Java SharedData: a ring buffer
+// guarded by a mutex, with one condition for consumers waiting for data and
+// one for producers waiting for room.
+type BoundedBuffer[T any] struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    []T
+	head     int
+	count    int
+	closed   bool
+}
+
+// NewBoundedBuffer returns a buffer holding up to capacity values; a
+// capacity below one is raised to one.
+func NewBoundedBuffer[T any](capacity int) *BoundedBuffer[T] {
+	b := &BoundedBuffer[T]{items: make([]T, max(capacity, 1))}
+	b.notEmpty = sync.NewCond(&b.mu)
+	b.notFull = sync.NewCond(&b.mu)
+	return b
+}
+
+// Put appends v, waiting while the buffer is full. It fails with ErrClosed
+// once the buffer is closed and with the context error once ctx ends.
+func (b *BoundedBuffer[T]) Put(ctx context.Context, v T) error {
+	defer b.wakeOnDone(ctx)()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.count == len(b.items) && !b.closed && ctx.Err() == nil {
+		b.notFull.Wait()
+	}
+	if b.closed {
+		return ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.push(v)
+	return nil
+}
+
+// TryPut appends v if there is room and the buffer is open.
+func (b *BoundedBuffer[T]) TryPut(v T) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed || b.count == len(b.items) {
+		return false
+	}
+	b.push(v)
+	return true
+}
+
+// Get removes the oldest value, waiting while the buffer is empty. Values
+// put before Close are still handed out; after that it returns io.EOF.
+func (b *BoundedBuffer[T]) Get(ctx context.Context) (T, error) {
+	defer b.wakeOnDone(ctx)()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.count == 0 && !b.closed && ctx.Err() == nil {
+		b.notEmpty.Wait()
+	}
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	if b.count == 0 {
+		return zero, io.EOF
+	}
+	return b.pop(), nil
+}
+
+// wakeOnDone wakes every waiter once ctx ends so they can notice; the
+// returned function stops it.
+func (b *BoundedBuffer[T]) wakeOnDone(ctx context.Context) func() bool {
+	if ctx.Done() == nil {
+		return func() bool { return false }
+	}
+	return context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.notEmpty.Broadcast()
+		b.notFull.Broadcast()
+	})
+}
+
+// TryGet removes the oldest value if there is one.
+func (b *BoundedBuffer[T]) TryGet() (T, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.count == 0 {
+		var zero T
+		return zero, false
+	}
+	return b.pop(), true
+}
+
+// Close stops further puts and wakes everyone waiting. Closing twice is a
+// no-op.
+func (b *BoundedBuffer[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.notEmpty.Broadcast()
+	b.notFull.Broadcast()
+}
+
+func (b *BoundedBuffer[T]) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count
+}
+
+func (b *BoundedBuffer[T]) Cap() int {
+	return len(b.items)
+}
+
+// push and pop are called with mu held.
+func (b *BoundedBuffer[T]) push(v T) {
+	b.items[(b.head+b.count)%len(b.items)] = v
+	b.count++
+	b.notEmpty.Signal()
+}
+
+func (b *BoundedBuffer[T]) pop() T {
+	v := b.items[b.head]
+	var zero T
+	b.items[b.head] = zero
+	b.head = (b.head + 1) % len(b.items)
+	b.count--
+	b.notFull.Signal()
+	return v
+}
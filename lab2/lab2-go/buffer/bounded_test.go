@@ -0,0 +1,117 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// exchange runs producers producers putting 1..n each into q and consumers
+// consumers draining it, and returns the sum and count of what was taken.
+func exchange(t *testing.T, q Queue[int], n, producers, consumers int) (sum, count int) {
+	t.Helper()
+	ctx := context.Background()
+	var mu sync.Mutex
+	var taken sync.WaitGroup
+	for range consumers {
+		taken.Add(1)
+		go func() {
+			defer taken.Done()
+			s, c := 0, 0
+			for {
+				v, err := q.Get(ctx)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				s += v
+				c++
+			}
+			mu.Lock()
+			sum, count = sum+s, count+c
+			mu.Unlock()
+		}()
+	}
+	var put sync.WaitGroup
+	for range producers {
+		put.Add(1)
+		go func() {
+			defer put.Done()
+			for i := 1; i <= n; i++ {
+				if err := q.Put(ctx, i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	put.Wait()
+	q.Close()
+	taken.Wait()
+	return sum, count
+}
+
+func TestBoundedBufferExchange(t *testing.T) {
+	tests := []struct {
+		capacity, producers, consumers int
+	}{
+		{0, 1, 1},
+		{1, 1, 4},
+		{1, 4, 1},
+		{16, 3, 3},
+		{1024, 2, 8},
+	}
+	const n = 20000
+	for _, tt := range tests {
+		b := NewBoundedBuffer[int](tt.capacity)
+		sum, count := exchange(t, b, n, tt.producers, tt.consumers)
+		if want := tt.producers * n * (n + 1) / 2; sum != want || count != tt.producers*n {
+			t.Errorf("%+v: took %d values summing to %d, want %d summing to %d", tt, count, sum, tt.producers*n, want)
+		}
+	}
+}
+
+func TestBoundedBufferTryAndClose(t *testing.T) {
+	b := NewBoundedBuffer[int](2)
+	if _, ok := b.TryGet(); ok {
+		t.Fatal("TryGet on an empty buffer succeeded")
+	}
+	if !b.TryPut(1) || !b.TryPut(2) || b.TryPut(3) {
+		t.Fatal("TryPut did not fill the buffer to its capacity")
+	}
+	if b.Len() != 2 || b.Cap() != 2 {
+		t.Fatalf("Len %d, Cap %d", b.Len(), b.Cap())
+	}
+	b.Close()
+	b.Close()
+	if err := b.Put(context.Background(), 4); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Put after Close: %v", err)
+	}
+	for want := 1; want <= 2; want++ {
+		if v, err := b.Get(context.Background()); err != nil || v != want {
+			t.Fatalf("Get after Close = %d, %v; want %d", v, err, want)
+		}
+	}
+	if _, err := b.Get(context.Background()); err != io.EOF {
+		t.Fatalf("Get on a closed, empty buffer: %v", err)
+	}
+}
+
+func TestBoundedBufferContext(t *testing.T) {
+	b := NewBoundedBuffer[int](1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get on an empty buffer: %v", err)
+	}
+	b.TryPut(1)
+	if err := b.Put(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Put on a full buffer: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+// Package buffer holds the transports a producer and its consumers can
+// exchange values over.
+package buffer
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrClosed = errors.New("buffer is closed")
+
+// Queue is a FIFO shared by producers and consumers. Put blocks while the
+// queue is full and Get while it is empty; both give up with the context
+// error once ctx ends. Get returns io.EOF once the queue is closed and
+// empty.
+type Queue[T any] interface {
+	Put(ctx context.Context, v T) error
+	Get(ctx context.Context) (T, error)
+	Close()
+}
+
+// Chan is a Queue backed by a Go channel. Put on a closed Chan panics, like
+// a send on a closed channel.
+type Chan[T any] chan T
+
+func NewChan[T any](capacity int) Chan[T] {
+	return make(Chan[T], capacity)
+}
+
+func (c Chan[T]) Put(ctx context.Context, v T) error {
+	select {
+	case c <- v:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c Chan[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case v, ok := <-c:
+		if !ok {
+			return v, io.EOF
+		}
+		return v, nil
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+func (c Chan[T]) Close() {
+	close(c)
+}
@@ -0,0 +1,203 @@
+package buffer
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Mode is how many goroutines may take values out of a Ring. There is only
+// ever one producer.
+type Mode int
+
+const (
+	// SPSC is a single consumer: it takes values with plain atomic loads and
+	// stores.
+	SPSC Mode = iota
+	// SPMC lets any number of consumers compete for values; each claims its
+	// slot with a compare-and-swap on the head.
+	SPMC
+)
+
+func (m Mode) String() string {
+	if m == SPSC {
+		return "spsc"
+	}
+	return "spmc"
+}
+
+const cacheLine = 64
+
+// Ring is a fixed-capacity lock-free queue for one producer. Every slot
+// carries a sequence number telling whose turn it is: the slot for position
+// pos is free for the producer when its sequence is pos and holds a value
+// for the consumers when it is pos+1. The head and the tail sit on cache
+// lines of their own so the producer and the consumers do not invalidate
+// each other's.
+//
+// Put, TryPut and Close must only be called by the producer. Waiting is
+// done by spinning and then yielding the processor, never by parking on a
+// lock.
+type Ring[T any] struct {
+	_      [cacheLine]byte
+	head   atomic.Uint64 // next position to take, moved by the consumers
+	_      [cacheLine - 8]byte
+	tail   atomic.Uint64 // next position to fill, moved by the producer
+	_      [cacheLine - 8]byte
+	closed atomic.Bool
+	_      [cacheLine - 4]byte
+	mask   uint64
+	mode   Mode
+	slots  []slot[T]
+}
+
+type slot[T any] struct {
+	seq   atomic.Uint64
+	value T
+}
+
+// NewRing returns a ring holding capacity values rounded up to a power of
+// two; a capacity below two is raised to two.
+func NewRing[T any](capacity int, mode Mode) *Ring[T] {
+	size := 2
+	for size < capacity {
+		size <<= 1
+	}
+	r := &Ring[T]{mask: uint64(size - 1), mode: mode, slots: make([]slot[T], size)}
+	for i := range r.slots {
+		r.slots[i].seq.Store(uint64(i))
+	}
+	return r
+}
+
+// Put appends v, waiting while the ring is full. It fails with ErrClosed
+// once the ring is closed and with the context error once ctx ends.
+func (r *Ring[T]) Put(ctx context.Context, v T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for spins := 0; ; spins++ {
+		if r.closed.Load() {
+			return ErrClosed
+		}
+		if r.TryPut(v) {
+			return nil
+		}
+		if err := backoff(ctx, spins); err != nil {
+			return err
+		}
+	}
+}
+
+// TryPut appends v if there is room and the ring is open.
+func (r *Ring[T]) TryPut(v T) bool {
+	if r.closed.Load() {
+		return false
+	}
+	pos := r.tail.Load()
+	s := &r.slots[pos&r.mask]
+	if s.seq.Load() != pos {
+		return false
+	}
+	s.value = v
+	s.seq.Store(pos + 1)
+	r.tail.Store(pos + 1)
+	return true
+}
+
+// Get removes the oldest value, waiting while the ring is empty. Values put
+// before Close are still handed out; after that it returns io.EOF.
+func (r *Ring[T]) Get(ctx context.Context) (T, error) {
+	if err := ctx.Err(); err != nil {
+		var zero T
+		return zero, err
+	}
+	for spins := 0; ; spins++ {
+		if v, ok := r.TryGet(); ok {
+			return v, nil
+		}
+		if r.closed.Load() {
+			// The producer may have put a last value between the two loads.
+			if v, ok := r.TryGet(); ok {
+				return v, nil
+			}
+			var zero T
+			return zero, io.EOF
+		}
+		if err := backoff(ctx, spins); err != nil {
+			var zero T
+			return zero, err
+		}
+	}
+}
+
+// TryGet removes the oldest value if there is one.
+func (r *Ring[T]) TryGet() (T, bool) {
+	var zero T
+	for {
+		pos := r.head.Load()
+		s := &r.slots[pos&r.mask]
+		switch seq := s.seq.Load(); {
+		case seq == pos+1:
+			if r.mode == SPSC {
+				r.head.Store(pos + 1)
+			} else if !r.head.CompareAndSwap(pos, pos+1) {
+				continue
+			}
+			v := s.value
+			s.value = zero
+			s.seq.Store(pos + r.mask + 1)
+			return v, true
+		case int64(seq-pos) <= 0:
+			return zero, false
+		}
+		// Another consumer took the value at pos after we loaded the head.
+	}
+}
+
+// Close stops further puts; consumers drain what is left and then get
+// io.EOF. Closing twice is a no-op.
+func (r *Ring[T]) Close() {
+	r.closed.Store(true)
+}
+
+// Len is the number of values waiting; with concurrent consumers it is only
+// a snapshot.
+func (r *Ring[T]) Len() int {
+	tail, head := r.tail.Load(), r.head.Load()
+	if tail < head {
+		return 0
+	}
+	return int(tail - head)
+}
+
+func (r *Ring[T]) Cap() int {
+	return len(r.slots)
+}
+
+func (r *Ring[T]) Mode() Mode {
+	return r.mode
+}
+
+// backoff is called after the spins-th failed attempt: it retries right away
+// at first, then yields the processor and finally sleeps, so waiting on an
+// idle ring does not starve the goroutine that would fill or empty it. It
+// returns the context error once ctx ends.
+func backoff(ctx context.Context, spins int) error {
+	switch {
+	case spins < 16:
+		return nil
+	case spins%64 == 0:
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if spins < 1024 {
+		runtime.Gosched()
+	} else {
+		time.Sleep(50 * time.Microsecond)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRingExchange(t *testing.T) {
+	tests := []struct {
+		mode      Mode
+		capacity  int
+		consumers int
+	}{
+		{SPSC, 0, 1},
+		{SPSC, 2, 1},
+		{SPSC, 1000, 1},
+		{SPMC, 1, 2},
+		{SPMC, 3, 6},
+		{SPMC, 64, 8},
+	}
+	const n = 50000
+	for _, tt := range tests {
+		r := NewRing[int](tt.capacity, tt.mode)
+		sum, count := exchange(t, r, n, 1, tt.consumers)
+		if sum != n*(n+1)/2 || count != n {
+			t.Errorf("%s ring of %d with %d consumers: took %d values summing to %d", tt.mode, tt.capacity, tt.consumers, count, sum)
+		}
+	}
+}
+
+func TestRingOrder(t *testing.T) {
+	r := NewRing[int](4, SPSC)
+	go func() {
+		for i := range 10000 {
+			r.Put(context.Background(), i)
+		}
+		r.Close()
+	}()
+	for want := 0; ; want++ {
+		v, err := r.Get(context.Background())
+		if err == io.EOF {
+			if want != 10000 {
+				t.Fatalf("EOF after %d values", want)
+			}
+			return
+		}
+		if v != want {
+			t.Fatalf("got %d, want %d", v, want)
+		}
+	}
+}
+
+func TestRingCapacity(t *testing.T) {
+	for capacity, want := range map[int]int{0: 2, 1: 2, 2: 2, 3: 4, 1000: 1024} {
+		if got := NewRing[int](capacity, SPMC).Cap(); got != want {
+			t.Errorf("capacity %d: Cap %d, want %d", capacity, got, want)
+		}
+	}
+}
+
+func TestRingTryAndClose(t *testing.T) {
+	r := NewRing[int](2, SPMC)
+	if _, ok := r.TryGet(); ok {
+		t.Fatal("TryGet on an empty ring succeeded")
+	}
+	if !r.TryPut(1) || !r.TryPut(2) || r.TryPut(3) {
+		t.Fatal("TryPut did not fill the ring to its capacity")
+	}
+	if r.Len() != 2 {
+		t.Fatalf("Len %d", r.Len())
+	}
+	r.Close()
+	if err := r.Put(context.Background(), 4); !errors.Is(err, ErrClosed) || r.TryPut(4) {
+		t.Fatalf("Put after Close: %v", err)
+	}
+	for want := 1; want <= 2; want++ {
+		if v, err := r.Get(context.Background()); err != nil || v != want {
+			t.Fatalf("Get after Close = %d, %v; want %d", v, err, want)
+		}
+	}
+	if _, err := r.Get(context.Background()); err != io.EOF {
+		t.Fatalf("Get on a closed, empty ring: %v", err)
+	}
+}
+
+func TestRingContext(t *testing.T) {
+	r := NewRing[int](2, SPMC)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get on an empty ring: %v", err)
+	}
+	r.TryPut(1)
+	r.TryPut(2)
+	if err := r.Put(ctx, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Put on a full ring: %v", err)
+	}
+	if _, err := r.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get with the context done: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+// Package group runs the goroutines of one job under a shared context: the
+// first one to fail cancels the others, and Wait reports that first error.
+package group
+
+import (
+	"context"
+	"sync"
+)
+
+type Group struct {
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+// WithContext returns a group and the context its goroutines must watch; it
+// is cancelled when one of them fails or Wait returns.
+func WithContext(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Group{cancel: cancel}, ctx
+}
+
+func (g *Group) Go(f func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := f(); err != nil {
+			g.once.Do(func() {
+				g.err = err
+				g.cancel(err)
+			})
+		}
+	}()
+}
+
+// Wait waits for every goroutine and returns the first error.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel(nil)
+	return g.err
+}
@@ -1,53 +1,369 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"lab2-go/buffer"
+	"lab2-go/group"
+	"lab2-go/pipeline"
+	"lab2-go/reduce"
+	"lab2-go/vecio"
+	"log"
+	"os"
+	"time"
 )
 
-type Producer struct {
-	value chan int
+// Producer sends the products in chunks of up to chunk values, so the
+// synchronization cost is paid once per chunk instead of once per element.
+type Producer[T reduce.Number] struct {
+	value buffer.Queue[[]T]
+	chunk int
 }
 
-type Consumer struct {
-	value  chan int
-	result chan int
+type Consumer[T reduce.Number] struct {
+	value  buffer.Queue[[]T]
+	result chan T
 }
 
-func (p *Producer) scalarProduct(vector1, vector2 []int) {
+// errOverflow is what a consumer fails with when its partial sum no longer
+// fits the element type.
+var errOverflow = errors.New("partial sum overflows")
+
+// errNoConsumers is returned for fewer than one consumer: nothing would
+// take the products and the producer would wait forever.
+var errNoConsumers = errors.New("at least one consumer is needed")
+
+// scalarProduct sends the products of vector1 and vector2 and closes the
+// queue, also when it fails.
+func (p *Producer[T]) scalarProduct(ctx context.Context, vector1, vector2 []T) error {
+	defer p.value.Close()
+	if len(vector1) != len(vector2) {
+		return reduce.ErrLengthMismatch
+	}
+	chunk := max(p.chunk, 1)
+	for start := 0; start < len(vector1); start += chunk {
+		end := min(start+chunk, len(vector1))
+		products := make([]T, end-start)
+		for i := start; i < end; i++ {
+			products[i-start] = vector1[i] * vector2[i]
+		}
+		if err := p.value.Put(ctx, products); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scalarProductStream is scalarProduct for vectors read from r1 and r2
+// chunk by chunk. It returns the number of products sent; the vectors
+// having different lengths is an error found only once the shorter one
+// ends.
+func (p *Producer[T]) scalarProductStream(ctx context.Context, r1, r2 vecio.Reader[T]) (int, error) {
+	defer p.value.Close()
+	chunk := max(p.chunk, 1)
+	buf1, buf2 := make([]T, chunk), make([]T, chunk)
+	count := 0
+	for {
+		n1, err1 := vecio.ReadFull(r1, buf1)
+		n2, err2 := vecio.ReadFull(r2, buf2)
+		for _, err := range []error{err1, err2} {
+			if err != nil && err != io.EOF {
+				return count, err
+			}
+		}
+		if n1 != n2 || (err1 == io.EOF) != (err2 == io.EOF) {
+			return count + min(n1, n2), reduce.ErrLengthMismatch
+		}
+		if err1 == io.EOF {
+			return count, nil
+		}
+		products := make([]T, n1)
+		for i := range products {
+			products[i] = buf1[i] * buf2[i]
+		}
+		if err := p.value.Put(ctx, products); err != nil {
+			return count, err
+		}
+		count += n1
+	}
+}
+
+// consume adds up chunks until the queue is closed and drained and then
+// sends the sum on result, which must have room for it.
+func (c *Consumer[T]) consume(ctx context.Context) error {
+	var sum T
+	for {
+		products, err := c.value.Get(ctx)
+		if err == io.EOF {
+			c.result <- sum
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, value := range products {
+			next := sum + value
+			if value > 0 && next < sum || value < 0 && next > sum {
+				return errOverflow
+			}
+			sum = next
+		}
+	}
+}
+
+// Transport selects what the producer and the consumers share.
+type Transport string
+
+const (
+	// TransportChan is a Go channel; capacity 0 makes it unbuffered.
+	TransportChan Transport = "chan"
+	// TransportCond is a BoundedBuffer built on sync.Mutex and sync.Cond.
+	TransportCond Transport = "cond"
+	// TransportRing is a lock-free Ring, in SPSC mode for a single consumer
+	// and SPMC mode otherwise.
+	TransportRing Transport = "ring"
+)
+
+var Transports = []Transport{TransportChan, TransportCond, TransportRing}
+
+func newQueue[T any](transport Transport, capacity, consumers int) (buffer.Queue[[]T], error) {
+	switch transport {
+	case TransportChan:
+		return buffer.NewChan[[]T](capacity), nil
+	case TransportCond:
+		return buffer.NewBoundedBuffer[[]T](capacity), nil
+	case TransportRing:
+		mode := buffer.SPMC
+		if consumers == 1 {
+			mode = buffer.SPSC
+		}
+		return buffer.NewRing[[]T](capacity, mode), nil
+	}
+	return nil, fmt.Errorf("unknown transport %q", transport)
+}
+
+// runScalarProduct runs one producer and consumers consumers on queue and
+// returns the partial sum of every consumer. The first of them to fail
+// stops the others and its error is returned.
+func runScalarProduct[T reduce.Number](ctx context.Context, queue buffer.Queue[[]T], vector1, vector2 []T, chunk, consumers int) ([]T, error) {
+	if consumers < 1 {
+		return nil, errNoConsumers
+	}
+	g, ctx := group.WithContext(ctx)
+	producer := Producer[T]{queue, chunk}
+	results := startConsumers(ctx, g, queue, consumers)
+	g.Go(func() error { return producer.scalarProduct(ctx, vector1, vector2) })
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return collect(results), nil
+}
+
+func startConsumers[T reduce.Number](ctx context.Context, g *group.Group, queue buffer.Queue[[]T], consumers int) []chan T {
+	results := make([]chan T, consumers)
+	for i := range results {
+		results[i] = make(chan T, 1)
+		consumer := Consumer[T]{queue, results[i]}
+		g.Go(func() error { return consumer.consume(ctx) })
+	}
+	return results
+}
+
+func collect[T any](results []chan T) []T {
+	sums := make([]T, len(results))
+	for i, result := range results {
+		sums[i] = <-result
+	}
+	return sums
+}
+
+// fileOptions is how the vectors are read in file mode.
+type fileOptions struct {
+	vecio.Options
+	transport Transport
+	capacity  int
+	chunk     int
+	consumers int
+	timeout   time.Duration
+}
+
+// runFiles streams the vectors stored at path1 and path2 through a producer
+// and consumers and reports the dot product and the throughput.
+func runFiles[T vecio.Element](path1, path2 string, opt fileOptions) error {
+	if opt.consumers < 1 {
+		return errNoConsumers
+	}
+	r1, err := vecio.Open[T](path1, opt.Options)
+	if err != nil {
+		return err
+	}
+	defer r1.Close()
+	r2, err := vecio.Open[T](path2, opt.Options)
+	if err != nil {
+		return err
+	}
+	defer r2.Close()
+	queue, err := newQueue[T](opt.transport, opt.capacity, opt.consumers)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if opt.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	g, ctx := group.WithContext(ctx)
+	producer := Producer[T]{queue, opt.chunk}
+	results := startConsumers(ctx, g, queue, opt.consumers)
+	var count int
+	g.Go(func() error {
+		var err error
+		count, err = producer.scalarProductStream(ctx, r1, r2)
+		return err
+	})
+	err = g.Wait()
+	elapsed := time.Since(start)
+	if err != nil {
+		return fmt.Errorf("after %d elements: %w", count, err)
+	}
+
+	var total T
+	for _, sum := range collect(results) {
+		total += sum
+	}
+	fmt.Printf("dot product: %v\n", total)
+	fmt.Printf("%d elements in %v: %.0f elements/s with %d consumers, %s buffer of %d chunks of %d\n",
+		count, elapsed.Round(time.Microsecond), float64(count)/elapsed.Seconds(),
+		opt.consumers, opt.transport, opt.capacity, opt.chunk)
+	return nil
+}
+
+// scalarProductPipeline is the producer/consumer scalar product as a
+// pipeline: one stage generates the products, consumers copies of a fold
+// stage each sum the products they take and the partial sums are merged.
+// Like runScalarProduct it fails on vectors of different lengths and when
+// ctx ends before the sum is complete.
+func scalarProductPipeline(ctx context.Context, vector1, vector2 []int, consumers int) ([]int, int, error) {
+	if consumers < 1 {
+		return nil, 0, errNoConsumers
+	}
 	if len(vector1) != len(vector2) {
-		panic("vector length mismatch")
+		return nil, 0, reduce.ErrLengthMismatch
 	}
-	for i := 0; i < len(vector1); i++ {
-		p.value <- vector1[i] * vector2[i]
+	add := func(acc, v int) int { return acc + v }
+	products := pipeline.Generate(ctx, len(vector1), func(i int) int { return vector1[i] * vector2[i] }, 0)
+	sums := pipeline.FanOut(ctx, products, consumers, pipeline.Fold(0, add))
+	partials := pipeline.Collect(ctx, pipeline.FanIn(ctx, consumers, sums...))
+	sum := pipeline.Reduce(ctx, pipeline.FromSlice(ctx, partials, 0), 0, add)
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
 	}
-	close(p.value)
+	return partials, sum, nil
 }
 
-func (c *Consumer) consume() {
-	sum := 0
-	for value := range c.value {
-		sum += value
+// describeProducts streams the products in chunks to consumers consumers and
+// reduces them deterministically, then prints their norms and statistics.
+func describeProducts(vector1, vector2 []int, chunk, consumers int) {
+	ctx := context.Background()
+	products := make([]int, len(vector1))
+	for i := range products {
+		products[i] = vector1[i] * vector2[i]
 	}
-	c.result <- sum
+	dot := reduce.Stream(ctx, reduce.Chunks(ctx, products, chunk, consumers), consumers, true, reduce.SumReducer[int]())
+	opt := reduce.Options{Workers: consumers, Deterministic: true}
+	minimum, maximum := reduce.Min(products, opt), reduce.Max(products, opt)
+	moments := reduce.MeanVariance(products, opt)
+	fmt.Println("reduce: dot product", dot)
+	fmt.Printf("reduce: products L1 %d, L2 %.3f, Linf %d\n", reduce.L1(products, opt), reduce.L2(products, opt), reduce.Linf(products, opt))
+	fmt.Printf("reduce: min %d at %d, max %d at %d\n", minimum.Value, minimum.Index, maximum.Value, maximum.Index)
+	fmt.Printf("reduce: mean %.3f, variance %.3f\n", moments.Mean, moments.Variance())
 }
 
 func main() {
+	transport := flag.String("transport", string(TransportChan), "producer/consumer transport: chan, cond or ring")
+	capacity := flag.Int("capacity", 0, "buffer capacity in chunks (a cond buffer holds at least one, a ring a power of two of at least two)")
+	chunk := flag.Int("chunk", 1024, "products per chunk sent to the consumers")
+	consumers := flag.Int("consumers", 2, "number of consumers")
+	bench := flag.Bool("bench", false, "compare transports, capacities, chunk sizes and consumer counts and exit")
+	length := flag.Int("n", 4_000_000, "vector length for the benchmark")
+	path1 := flag.String("a", "", "file holding the first vector; with -b, stream both files instead of the built-in vectors")
+	path2 := flag.String("b", "", "file holding the second vector")
+	format := flag.String("format", string(vecio.FormatText), "vector file format: text, csv, int64 or float64 (little-endian binary)")
+	column := flag.Int("column", 0, "zero-based CSV column holding the vector")
+	header := flag.Bool("header", false, "skip the first CSV record")
+	timeout := flag.Duration("timeout", 0, "give up streaming the files after this long (0 means no limit)")
+	element := flag.String("type", "", "element type, int64 or float64 (defaults to the binary format, else int64)")
+	flag.Parse()
+
+	if *consumers < 1 {
+		log.Fatal("-consumers must be at least 1")
+	}
+	if *bench {
+		runBenchmark(*length, Transport(*transport), *capacity, *chunk)
+		return
+	}
+
+	if *path1 != "" || *path2 != "" {
+		if *path1 == "" || *path2 == "" {
+			log.Fatal("-a and -b go together")
+		}
+		opt := fileOptions{
+			Options:   vecio.Options{Format: vecio.Format(*format), Column: *column, Header: *header},
+			transport: Transport(*transport),
+			capacity:  *capacity,
+			chunk:     *chunk,
+			consumers: *consumers,
+			timeout:   *timeout,
+		}
+		if *element == "" && opt.Format == vecio.FormatFloat64 {
+			*element = "float64"
+		}
+		var err error
+		switch *element {
+		case "", "int64":
+			err = runFiles[int64](*path1, *path2, opt)
+		case "float64":
+			err = runFiles[float64](*path1, *path2, opt)
+		default:
+			err = fmt.Errorf("unknown element type %q", *element)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	vector1 := []int{1, 3, -2}
 	vector2 := []int{4, -1, 5}
-	valueChan := make(chan int)
-	resultChan1 := make(chan int)
-	resultChan2 := make(chan int)
-
-	producer := Producer{valueChan}
-	consumer1 := Consumer{valueChan, resultChan1}
-	consumer2 := Consumer{valueChan, resultChan2}
-	go producer.scalarProduct(vector1, vector2)
-	go consumer1.consume()
-	go consumer2.consume()
-	sum1 := <-resultChan1
-	sum2 := <-resultChan2
-	fmt.Println("result: 1", sum1)
-	fmt.Println("result: 2", sum2)
-	fmt.Println("result: 3", sum1+sum2)
+	queue, err := newQueue[int](Transport(*transport), *capacity, *consumers)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sums, err := runScalarProduct(context.Background(), queue, vector1, vector2, *chunk, *consumers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	total := 0
+	for i, sum := range sums {
+		fmt.Println("result:", i+1, sum)
+		total += sum
+	}
+	fmt.Println("total:", total)
+
+	partials, sum, err := scalarProductPipeline(context.Background(), vector1, vector2, *consumers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("pipeline partial sums:", partials)
+	fmt.Println("pipeline result:", sum)
 
+	describeProducts(vector1, vector2, *chunk, *consumers)
 }
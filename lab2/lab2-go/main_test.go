@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"lab2-go/reduce"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScalarProductErrors(t *testing.T) {
+	big, ones := make([]int, 10_000), make([]int, 10_000)
+	for i := range big {
+		big[i], ones[i] = math.MaxInt32, 1
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name             string
+		ctx              context.Context
+		vector1, vector2 []int
+		want             error
+		consumers        []int
+	}{
+		{"ok", context.Background(), []int{1, 3, -2}, []int{4, -1, 5}, nil, nil},
+		{"length mismatch", context.Background(), []int{1, 2}, []int{1}, reduce.ErrLengthMismatch, nil},
+		{"overflow", context.Background(), big, big, errOverflow, nil},
+		{"cancelled", cancelled, ones, ones, context.Canceled, nil},
+		{"no consumers", context.Background(), ones, ones, errNoConsumers, []int{0, -1}},
+	}
+	for _, tt := range tests {
+		if tt.consumers == nil {
+			tt.consumers = []int{1, 3}
+		}
+		for _, transport := range Transports {
+			for _, consumers := range tt.consumers {
+				queue, err := newQueue[int](transport, 2, consumers)
+				if err != nil {
+					t.Fatal(err)
+				}
+				done := make(chan struct{})
+				var sums []int
+				go func() {
+					defer close(done)
+					sums, err = runScalarProduct(tt.ctx, queue, tt.vector1, tt.vector2, 4, consumers)
+				}()
+				select {
+				case <-done:
+				case <-time.After(10 * time.Second):
+					t.Fatalf("%s over %s with %d consumers did not terminate", tt.name, transport, consumers)
+				}
+				if !errors.Is(err, tt.want) {
+					t.Errorf("%s over %s with %d consumers: %v, want %v", tt.name, transport, consumers, err, tt.want)
+				}
+				if tt.want == nil {
+					total := 0
+					for _, sum := range sums {
+						total += sum
+					}
+					if total != -9 {
+						t.Errorf("%s over %s with %d consumers: total %d", tt.name, transport, consumers, total)
+					}
+				}
+			}
+		}
+	}
+	if err := runFiles[int64]("missing-a", "missing-b", fileOptions{transport: TransportChan}); !errors.Is(err, errNoConsumers) {
+		t.Errorf("files without consumers: %v, want %v", err, errNoConsumers)
+	}
+}
+
+func TestScalarProductPipelineErrors(t *testing.T) {
+	if _, sum, err := scalarProductPipeline(context.Background(), []int{1, 3, -2}, []int{4, -1, 5}, 2); err != nil || sum != -9 {
+		t.Errorf("got %d, %v; want -9", sum, err)
+	}
+	if _, _, err := scalarProductPipeline(context.Background(), []int{1, 2}, []int{1}, 2); !errors.Is(err, reduce.ErrLengthMismatch) {
+		t.Errorf("length mismatch: %v", err)
+	}
+	if _, _, err := scalarProductPipeline(context.Background(), []int{1}, []int{1}, 0); !errors.Is(err, errNoConsumers) {
+		t.Errorf("no consumers: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := scalarProductPipeline(ctx, make([]int, 1000), make([]int, 1000), 2); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// FanOut runs n copies of stage that share the input: every item goes to
+// whichever copy takes it first. It returns the output of each copy.
+func FanOut[In, Out any](ctx context.Context, in <-chan In, n int, stage Stage[In, Out]) []<-chan Out {
+	outs := make([]<-chan Out, n)
+	for i := range outs {
+		outs[i] = stage(ctx, in)
+	}
+	return outs
+}
+
+// FanIn merges streams in arrival order and closes the result once all of
+// them are closed.
+func FanIn[T any](ctx context.Context, buffer int, ins ...<-chan T) <-chan T {
+	out := make(chan T, buffer)
+	var wg sync.WaitGroup
+	for _, in := range ins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range in {
+				if !send(ctx, out, v) {
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// Seq is an item tagged with its position in the original stream, so it can
+// be put back in order after a fan-out.
+type Seq[T any] struct {
+	Index int
+	Value T
+}
+
+// Number tags every item with its position.
+func Number[T any](ctx context.Context, in <-chan T, buffer int) <-chan Seq[T] {
+	out := make(chan Seq[T], buffer)
+	go func() {
+		defer close(out)
+		i := 0
+		for v := range in {
+			if !send(ctx, out, Seq[T]{Index: i, Value: v}) {
+				return
+			}
+			i++
+		}
+	}()
+	return out
+}
+
+// MapSeq applies fn to the value of numbered items and keeps the number.
+func MapSeq[In, Out any](fn func(In) Out, buffer int) Stage[Seq[In], Seq[Out]] {
+	return Map(func(s Seq[In]) Seq[Out] { return Seq[Out]{Index: s.Index, Value: fn(s.Value)} }, buffer)
+}
+
+// MergeOrdered merges numbered streams back into the original order. Every
+// index from 0 up must appear exactly once across the inputs; items that
+// arrive early wait in memory until the gap before them is filled.
+func MergeOrdered[T any](ctx context.Context, buffer int, ins ...<-chan Seq[T]) <-chan T {
+	merged := FanIn(ctx, 0, ins...)
+	out := make(chan T, buffer)
+	go func() {
+		defer close(out)
+		var pending seqHeap[T]
+		next := 0
+		for s := range merged {
+			heap.Push(&pending, s)
+			for len(pending) > 0 && pending[0].Index == next {
+				if !send(ctx, out, heap.Pop(&pending).(Seq[T]).Value) {
+					return
+				}
+				next++
+			}
+		}
+	}()
+	return out
+}
+
+// ParallelMap applies fn to every item on n goroutines. With ordered set the
+// output keeps the input order, otherwise items come out as they finish.
+func ParallelMap[In, Out any](n int, fn func(In) Out, buffer int, ordered bool) Stage[In, Out] {
+	return func(ctx context.Context, in <-chan In) <-chan Out {
+		if !ordered {
+			return FanIn(ctx, buffer, FanOut(ctx, in, n, Map(fn, buffer))...)
+		}
+		numbered := Number(ctx, in, buffer)
+		return MergeOrdered(ctx, buffer, FanOut(ctx, numbered, n, MapSeq(fn, buffer))...)
+	}
+}
+
+type seqHeap[T any] []Seq[T]
+
+func (h seqHeap[T]) Len() int           { return len(h) }
+func (h seqHeap[T]) Less(i, j int) bool { return h[i].Index < h[j].Index }
+func (h seqHeap[T]) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *seqHeap[T]) Push(x any)        { *h = append(*h, x.(Seq[T])) }
+func (h *seqHeap[T]) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
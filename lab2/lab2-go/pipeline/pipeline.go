@@ -0,0 +1,137 @@
+// Package pipeline composes the producer/consumer pattern into multi-stage
+// streaming jobs. Every stage reads from one channel and writes to another,
+// runs on its own goroutines and closes its output once its input is drained
+// or the context is cancelled. The buffer argument bounds how many items a
+// stage may run ahead of the next one; 0 makes the hand-off synchronous.
+package pipeline
+
+import "context"
+
+// Stage turns one stream into another.
+type Stage[In, Out any] func(ctx context.Context, in <-chan In) <-chan Out
+
+// Then runs next on the output of s.
+func Then[A, B, C any](s Stage[A, B], next Stage[B, C]) Stage[A, C] {
+	return func(ctx context.Context, in <-chan A) <-chan C {
+		return next(ctx, s(ctx, in))
+	}
+}
+
+// send delivers v unless ctx ends first.
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// FromSlice emits the items in order.
+func FromSlice[T any](ctx context.Context, items []T, buffer int) <-chan T {
+	return Generate(ctx, len(items), func(i int) T { return items[i] }, buffer)
+}
+
+// Generate emits fn(0), ..., fn(n-1).
+func Generate[T any](ctx context.Context, n int, fn func(i int) T, buffer int) <-chan T {
+	out := make(chan T, buffer)
+	go func() {
+		defer close(out)
+		for i := 0; i < n; i++ {
+			if !send(ctx, out, fn(i)) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Map applies fn to every item.
+func Map[In, Out any](fn func(In) Out, buffer int) Stage[In, Out] {
+	return func(ctx context.Context, in <-chan In) <-chan Out {
+		out := make(chan Out, buffer)
+		go func() {
+			defer close(out)
+			for v := range in {
+				if !send(ctx, out, fn(v)) {
+					return
+				}
+			}
+		}()
+		return out
+	}
+}
+
+// Filter keeps the items keep accepts.
+func Filter[T any](keep func(T) bool, buffer int) Stage[T, T] {
+	return func(ctx context.Context, in <-chan T) <-chan T {
+		out := make(chan T, buffer)
+		go func() {
+			defer close(out)
+			for v := range in {
+				if keep(v) && !send(ctx, out, v) {
+					return
+				}
+			}
+		}()
+		return out
+	}
+}
+
+// Fold combines the whole stream into a single value and emits it once the
+// input is closed; it emits nothing if ctx ends first.
+func Fold[In, Acc any](init Acc, fn func(Acc, In) Acc) Stage[In, Acc] {
+	return func(ctx context.Context, in <-chan In) <-chan Acc {
+		out := make(chan Acc, 1)
+		go func() {
+			defer close(out)
+			acc := init
+			for v := range in {
+				if ctx.Err() != nil {
+					return
+				}
+				acc = fn(acc, v)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			send(ctx, out, acc)
+		}()
+		return out
+	}
+}
+
+// Buffer passes items through unchanged, letting the producer run up to
+// size items ahead of the consumer.
+func Buffer[T any](size int) Stage[T, T] {
+	return Map(func(v T) T { return v }, size)
+}
+
+// Drain reads the stream to the end, which waits for every stage before it
+// to finish.
+func Drain[T any](in <-chan T) {
+	for range in {
+	}
+}
+
+// Collect returns every item of the stream in arrival order.
+func Collect[T any](ctx context.Context, in <-chan T) []T {
+	var items []T
+	for v := range in {
+		if ctx.Err() == nil {
+			items = append(items, v)
+		}
+	}
+	return items
+}
+
+// Reduce folds the stream on the caller's goroutine.
+func Reduce[T, Acc any](ctx context.Context, in <-chan T, init Acc, fn func(Acc, T) Acc) Acc {
+	acc := init
+	for v := range in {
+		if ctx.Err() == nil {
+			acc = fn(acc, v)
+		}
+	}
+	return acc
+}
@@ -0,0 +1,170 @@
+package pipeline
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// within fails the test if fn does not return before the deadline, which is
+// how a stage that forgets to close its output shows up.
+func within(t *testing.T, what string, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%s did not finish", what)
+	}
+}
+
+func seqs(indices ...int) <-chan Seq[int] {
+	ch := make(chan Seq[int], len(indices))
+	for _, i := range indices {
+		ch <- Seq[int]{Index: i, Value: i * 10}
+	}
+	close(ch)
+	return ch
+}
+
+func TestMergeOrdered(t *testing.T) {
+	tests := []struct {
+		name string
+		ins  [][]int
+	}{
+		{"in order", [][]int{{0, 1, 2, 3}}},
+		{"gaps arrive early", [][]int{{4, 2, 0, 3, 1}}},
+		{"last first", [][]int{{5, 4, 3, 2, 1, 0}}},
+		{"split", [][]int{{3, 5, 1}, {4, 0, 2}}},
+		{"empty input", [][]int{{}, {1, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var ins []<-chan Seq[int]
+			n := 0
+			for _, indices := range tt.ins {
+				ins = append(ins, seqs(indices...))
+				n += len(indices)
+			}
+			var got []int
+			within(t, "MergeOrdered", func() { got = Collect(ctx, MergeOrdered(ctx, 0, ins...)) })
+			want := make([]int, n)
+			for i := range want {
+				want[i] = i * 10
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParallelMap(t *testing.T) {
+	const n = 1000
+	items := make([]int, n)
+	for i := range items {
+		items[i] = i
+	}
+	square := func(v int) int {
+		if v%7 == 0 {
+			// Let later items overtake this one.
+			time.Sleep(time.Microsecond)
+		}
+		return v * v
+	}
+	for _, ordered := range []bool{true, false} {
+		for _, workers := range []int{1, 4} {
+			ctx := context.Background()
+			var got []int
+			within(t, "ParallelMap", func() {
+				got = Collect(ctx, ParallelMap(workers, square, 2, ordered)(ctx, FromSlice(ctx, items, 0)))
+			})
+			if !ordered {
+				slices.Sort(got)
+			}
+			if len(got) != n {
+				t.Fatalf("ordered %v, %d workers: %d items, want %d", ordered, workers, len(got), n)
+			}
+			for i, v := range got {
+				if v != i*i {
+					t.Errorf("ordered %v, %d workers: item %d is %d, want %d", ordered, workers, i, v, i*i)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestFanOutFanInExactlyOnce(t *testing.T) {
+	const n = 10_000
+	ctx := context.Background()
+	in := Generate(ctx, n, func(i int) int { return i }, 0)
+	outs := FanOut(ctx, in, 4, Buffer[int](3))
+	var got []int
+	within(t, "FanIn", func() { got = Collect(ctx, FanIn(ctx, 0, outs...)) })
+	seen := make([]int, n)
+	for _, v := range got {
+		seen[v]++
+	}
+	for i, count := range seen {
+		if count != 1 {
+			t.Errorf("item %d delivered %d times", i, count)
+		}
+	}
+}
+
+func TestFanOutFanInCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// An endless source: only cancellation stops it.
+	in := Generate(ctx, int(^uint(0)>>1), func(i int) int { return i }, 0)
+	out := FanIn(ctx, 0, FanOut(ctx, in, 4, Map(func(v int) int { return v + 1 }, 1))...)
+	for range 100 {
+		<-out
+	}
+	cancel()
+	within(t, "cancelled fan-out", func() { Drain(out) })
+	within(t, "cancelled source", func() { Drain(in) })
+}
+
+func TestFold(t *testing.T) {
+	ctx := context.Background()
+	sum := Fold(0, func(acc, v int) int { return acc + v })
+	if got := Collect(ctx, sum(ctx, FromSlice(ctx, []int{1, 2, 3, 4}, 0))); !slices.Equal(got, []int{10}) {
+		t.Errorf("got %v, want [10]", got)
+	}
+
+	// The input closes only after ctx ends: the partial sum must not be
+	// emitted.
+	ctx, cancel := context.WithCancel(ctx)
+	in := make(chan int)
+	out := sum(ctx, in)
+	in <- 5
+	cancel()
+	close(in)
+	within(t, "cancelled Fold", func() {
+		if v, ok := <-out; ok {
+			t.Errorf("cancelled Fold emitted %d", v)
+		}
+	})
+}
+
+func TestThen(t *testing.T) {
+	ctx := context.Background()
+	even := Then(Buffer[int](4), Filter(func(v int) bool { return v%2 == 0 }, 0))
+	double := Then(even, Map(func(v int) int { return 2 * v }, 0))
+	got := Collect(ctx, double(ctx, FromSlice(ctx, []int{1, 2, 3, 4, 5, 6}, 0)))
+	if want := []int{4, 8, 12}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	numbered := Collect(ctx, Number(ctx, FromSlice(ctx, []string{"a", "b"}, 0), 0))
+	if want := []Seq[string]{{0, "a"}, {1, "b"}}; !slices.Equal(numbered, want) {
+		t.Errorf("got %v, want %v", numbered, want)
+	}
+}
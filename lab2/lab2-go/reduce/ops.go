@@ -0,0 +1,209 @@
+package reduce
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrLengthMismatch = errors.New("vector length mismatch")
+
+func abs[T Number](x T) T {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func add[T Number](a, b T) T { return a + b }
+
+// SumReducer adds the elements.
+func SumReducer[T Number]() Reducer[T, T] {
+	return Reducer[T, T]{Combine: add[T], Leaf: func(block []T, _ int) T {
+		var sum T
+		for _, x := range block {
+			sum += x
+		}
+		return sum
+	}}
+}
+
+// L1Reducer adds the absolute values.
+func L1Reducer[T Number]() Reducer[T, T] {
+	return Reducer[T, T]{Combine: add[T], Leaf: func(block []T, _ int) T {
+		var sum T
+		for _, x := range block {
+			sum += abs(x)
+		}
+		return sum
+	}}
+}
+
+// SumSquaresReducer adds the squares in float64, so integer inputs cannot
+// overflow; L2 is its square root.
+func SumSquaresReducer[T Number]() Reducer[T, float64] {
+	return Reducer[T, float64]{Combine: add[float64], Leaf: func(block []T, _ int) float64 {
+		var sum float64
+		for _, x := range block {
+			sum += float64(x) * float64(x)
+		}
+		return sum
+	}}
+}
+
+// LinfReducer takes the largest absolute value.
+func LinfReducer[T Number]() Reducer[T, T] {
+	return Reducer[T, T]{Combine: func(a, b T) T { return max(a, b) }, Leaf: func(block []T, _ int) T {
+		var m T
+		for _, x := range block {
+			m = max(m, abs(x))
+		}
+		return m
+	}}
+}
+
+// Extremum is the smallest or largest element and the position of its first
+// occurrence. Index is -1 for an empty input.
+type Extremum[T Number] struct {
+	Value T
+	Index int
+}
+
+// MinReducer finds the smallest element.
+func MinReducer[T Number]() Reducer[T, Extremum[T]] {
+	return extremumReducer(func(a, b T) bool { return a < b })
+}
+
+// MaxReducer finds the largest element.
+func MaxReducer[T Number]() Reducer[T, Extremum[T]] {
+	return extremumReducer(func(a, b T) bool { return a > b })
+}
+
+func extremumReducer[T Number](better func(a, b T) bool) Reducer[T, Extremum[T]] {
+	combine := func(a, b Extremum[T]) Extremum[T] {
+		switch {
+		case a.Index < 0:
+			return b
+		case b.Index < 0:
+			return a
+		case better(b.Value, a.Value), b.Value == a.Value && b.Index < a.Index:
+			return b
+		}
+		return a
+	}
+	return Reducer[T, Extremum[T]]{
+		Identity: Extremum[T]{Index: -1},
+		Combine:  combine,
+		Leaf: func(block []T, offset int) Extremum[T] {
+			e := Extremum[T]{Index: -1}
+			for i, x := range block {
+				if e.Index < 0 || better(x, e.Value) {
+					e = Extremum[T]{Value: x, Index: offset + i}
+				}
+			}
+			return e
+		},
+	}
+}
+
+// Moments are the count, mean and sum of squared deviations of the
+// elements, accumulated with Welford's method and merged with the parallel
+// formula of Chan et al.
+type Moments struct {
+	Count int
+	Mean  float64
+	M2    float64
+}
+
+// Variance is the population variance.
+func (m Moments) Variance() float64 {
+	if m.Count == 0 {
+		return math.NaN()
+	}
+	return m.M2 / float64(m.Count)
+}
+
+// SampleVariance is the unbiased sample variance.
+func (m Moments) SampleVariance() float64 {
+	if m.Count < 2 {
+		return math.NaN()
+	}
+	return m.M2 / float64(m.Count-1)
+}
+
+// MomentsReducer computes the mean and variance.
+func MomentsReducer[T Number]() Reducer[T, Moments] {
+	return Reducer[T, Moments]{
+		Combine: func(a, b Moments) Moments {
+			if a.Count == 0 {
+				return b
+			}
+			if b.Count == 0 {
+				return a
+			}
+			n := a.Count + b.Count
+			delta := b.Mean - a.Mean
+			return Moments{
+				Count: n,
+				Mean:  a.Mean + delta*float64(b.Count)/float64(n),
+				M2:    a.M2 + b.M2 + delta*delta*float64(a.Count)*float64(b.Count)/float64(n),
+			}
+		},
+		Leaf: func(block []T, _ int) Moments {
+			var m Moments
+			for _, x := range block {
+				m.Count++
+				delta := float64(x) - m.Mean
+				m.Mean += delta / float64(m.Count)
+				m.M2 += delta * (float64(x) - m.Mean)
+			}
+			return m
+		},
+	}
+}
+
+func Sum[T Number](xs []T, opt Options) T {
+	return Slice(xs, opt, SumReducer[T]())
+}
+
+// Dot is the dot product of x and y.
+func Dot[T Number](x, y []T, opt Options) (T, error) {
+	if len(x) != len(y) {
+		return 0, ErrLengthMismatch
+	}
+	r := SumReducer[T]()
+	return reduceRange(len(x), opt, func(start, end int) T {
+		var sum T
+		for i := start; i < end; i++ {
+			sum += x[i] * y[i]
+		}
+		return sum
+	}, r), nil
+}
+
+func L1[T Number](xs []T, opt Options) T {
+	return Slice(xs, opt, L1Reducer[T]())
+}
+
+func L2[T Number](xs []T, opt Options) float64 {
+	return math.Sqrt(Slice(xs, opt, SumSquaresReducer[T]()))
+}
+
+func Linf[T Number](xs []T, opt Options) T {
+	return Slice(xs, opt, LinfReducer[T]())
+}
+
+// Min returns the smallest element and its first index; the index is -1 if
+// xs is empty.
+func Min[T Number](xs []T, opt Options) Extremum[T] {
+	return Slice(xs, opt, MinReducer[T]())
+}
+
+// Max returns the largest element and its first index; the index is -1 if
+// xs is empty.
+func Max[T Number](xs []T, opt Options) Extremum[T] {
+	return Slice(xs, opt, MaxReducer[T]())
+}
+
+func MeanVariance[T Number](xs []T, opt Options) Moments {
+	return Slice(xs, opt, MomentsReducer[T]())
+}
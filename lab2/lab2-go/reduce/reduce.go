@@ -0,0 +1,183 @@
+// Package reduce runs reductions over slices and chunked streams in
+// parallel. A reduction folds blocks of consecutive elements and combines
+// the block results left to right; floating-point results therefore depend
+// on where the blocks are cut and in which order they are combined, which
+// the Deterministic option pins down.
+package reduce
+
+import (
+	"context"
+	"lab2-go/pipeline"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Number is an element type the reductions support.
+type Number interface {
+	~int | ~int64 | ~float64
+}
+
+// Reducer describes a reduction. Leaf folds a block of consecutive elements
+// whose first one is at offset in the whole input; Combine merges two
+// results, left first. Combine must be associative and, for the
+// non-deterministic stream mode, commutative up to rounding. Identity is the
+// result of an empty input and must leave any result unchanged.
+type Reducer[T, A any] struct {
+	Identity A
+	Leaf     func(block []T, offset int) A
+	Combine  func(left, right A) A
+}
+
+const DefaultBlockSize = 4096
+
+type Options struct {
+	// Workers defaults to GOMAXPROCS.
+	Workers int
+	// Deterministic cuts the input into blocks of BlockSize whatever the
+	// number of workers and combines the block results in a fixed balanced
+	// tree, so floating-point results are bit-identical for any Workers.
+	// Otherwise every worker folds one contiguous share of the input.
+	Deterministic bool
+	BlockSize     int
+}
+
+// Slice reduces xs.
+func Slice[T, A any](xs []T, opt Options, r Reducer[T, A]) A {
+	return reduceRange(len(xs), opt, func(start, end int) A { return r.Leaf(xs[start:end], start) }, r)
+}
+
+// reduceRange reduces the index range [0, n) with leaf doing the work for
+// each block.
+func reduceRange[T, A any](n int, opt Options, leaf func(start, end int) A, r Reducer[T, A]) A {
+	if n == 0 {
+		return r.Identity
+	}
+	workers := opt.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	size := (n + workers - 1) / workers
+	if opt.Deterministic {
+		size = opt.BlockSize
+		if size <= 0 {
+			size = DefaultBlockSize
+		}
+	}
+	blocks := (n + size - 1) / size
+	results := make([]A, blocks)
+
+	var wg sync.WaitGroup
+	next := make(chan int, blocks)
+	for b := 0; b < blocks; b++ {
+		next <- b
+	}
+	close(next)
+	for w := 0; w < min(workers, blocks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range next {
+				results[b] = leaf(b*size, min((b+1)*size, n))
+			}
+		}()
+	}
+	wg.Wait()
+	if opt.Deterministic {
+		return tree(results, r.Combine)
+	}
+	acc := results[0]
+	for _, res := range results[1:] {
+		acc = r.Combine(acc, res)
+	}
+	return acc
+}
+
+// tree combines results in a balanced binary tree whose shape only depends
+// on len(results).
+func tree[A any](results []A, combine func(A, A) A) A {
+	if len(results) == 1 {
+		return results[0]
+	}
+	mid := len(results) / 2
+	return combine(tree(results[:mid], combine), tree(results[mid:], combine))
+}
+
+// Chunk is a piece of a stream: Values are the elements at positions
+// Offset, Offset+1, ... of the whole stream.
+type Chunk[T any] struct {
+	Offset int
+	Values []T
+}
+
+// Chunks cuts xs into chunks of size elements and streams them in order.
+func Chunks[T any](ctx context.Context, xs []T, size, buffer int) <-chan Chunk[T] {
+	size = max(size, 1)
+	return pipeline.Generate(ctx, (len(xs)+size-1)/size, func(i int) Chunk[T] {
+		return Chunk[T]{Offset: i * size, Values: xs[i*size : min((i+1)*size, len(xs))]}
+	}, buffer)
+}
+
+// Stream reduces a stream of chunks with consumers goroutines. With
+// deterministic set the chunk results are combined in a fixed tree ordered
+// by offset, so the result depends only on how the producer cut the
+// chunks, not on the consumer count; otherwise each consumer folds the
+// chunks it happens to take and the consumer results are combined in
+// consumer order. If ctx ends first, the result covers only the chunks read
+// so far.
+func Stream[T, A any](ctx context.Context, in <-chan Chunk[T], consumers int, deterministic bool, r Reducer[T, A]) A {
+	consumers = max(consumers, 1)
+	type chunkResult struct {
+		offset int
+		result A
+	}
+	var mu sync.Mutex
+	var chunks []chunkResult
+	partials := make([]A, consumers)
+	var wg sync.WaitGroup
+	for c := 0; c < consumers; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			acc := r.Identity
+			for ctx.Err() == nil {
+				var chunk Chunk[T]
+				var ok bool
+				select {
+				case chunk, ok = <-in:
+				case <-ctx.Done():
+				}
+				if !ok {
+					break
+				}
+				res := r.Leaf(chunk.Values, chunk.Offset)
+				if !deterministic {
+					acc = r.Combine(acc, res)
+					continue
+				}
+				mu.Lock()
+				chunks = append(chunks, chunkResult{chunk.Offset, res})
+				mu.Unlock()
+			}
+			partials[c] = acc
+		}()
+	}
+	wg.Wait()
+
+	if !deterministic {
+		acc := partials[0]
+		for _, p := range partials[1:] {
+			acc = r.Combine(acc, p)
+		}
+		return acc
+	}
+	if len(chunks) == 0 {
+		return r.Identity
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].offset < chunks[j].offset })
+	results := make([]A, len(chunks))
+	for i, c := range chunks {
+		results[i] = c.result
+	}
+	return tree(results, r.Combine)
+}
@@ -0,0 +1,100 @@
+package reduce
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func randomFloats(n int, seed int64) []float64 {
+	rng := rand.New(rand.NewSource(seed))
+	xs := make([]float64, n)
+	for i := range xs {
+		xs[i] = rng.NormFloat64() * math.Pow(10, float64(rng.Intn(12)))
+	}
+	return xs
+}
+
+func TestDeterministicTree(t *testing.T) {
+	x, y := randomFloats(100_003, 1), randomFloats(100_003, 2)
+	tests := []struct {
+		name   string
+		reduce func(opt Options) float64
+	}{
+		{"sum", func(opt Options) float64 { return Sum(x, opt) }},
+		{"dot", func(opt Options) float64 { d, _ := Dot(x, y, opt); return d }},
+		{"l1", func(opt Options) float64 { return L1(x, opt) }},
+		{"l2", func(opt Options) float64 { return L2(x, opt) }},
+		{"variance", func(opt Options) float64 { return MeanVariance(x, opt).Variance() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.reduce(Options{Workers: 1, Deterministic: true})
+			for _, workers := range []int{2, 3, 7, 16, 64} {
+				got := tt.reduce(Options{Workers: workers, Deterministic: true})
+				if math.Float64bits(got) != math.Float64bits(want) {
+					t.Errorf("%d workers: %v, want %v bit for bit", workers, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamDeterministic(t *testing.T) {
+	xs := randomFloats(50_000, 3)
+	ctx := context.Background()
+	want := Stream(ctx, Chunks(ctx, xs, 1000, 0), 1, true, SumReducer[float64]())
+	for _, consumers := range []int{2, 5, 13} {
+		got := Stream(ctx, Chunks(ctx, xs, 1000, consumers), consumers, true, SumReducer[float64]())
+		if math.Float64bits(got) != math.Float64bits(want) {
+			t.Errorf("%d consumers: %v, want %v bit for bit", consumers, got, want)
+		}
+	}
+}
+
+func TestIntegerReductions(t *testing.T) {
+	xs := []int64{3, -7, 2, 9, -7, 9, 0}
+	tests := []struct {
+		name string
+		opt  Options
+	}{
+		{"one worker", Options{Workers: 1}},
+		{"per worker", Options{Workers: 3}},
+		{"fixed tree", Options{Workers: 4, Deterministic: true, BlockSize: 2}},
+		{"more workers than elements", Options{Workers: 32}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sum(xs, tt.opt); got != 9 {
+				t.Errorf("Sum = %d", got)
+			}
+			if got := L1(xs, tt.opt); got != 37 {
+				t.Errorf("L1 = %d", got)
+			}
+			if got := Linf(xs, tt.opt); got != 9 {
+				t.Errorf("Linf = %d", got)
+			}
+			if got := Min(xs, tt.opt); got != (Extremum[int64]{Value: -7, Index: 1}) {
+				t.Errorf("Min = %+v", got)
+			}
+			if got := Max(xs, tt.opt); got != (Extremum[int64]{Value: 9, Index: 3}) {
+				t.Errorf("Max = %+v", got)
+			}
+			if got, err := Dot(xs, xs, tt.opt); err != nil || got != 273 {
+				t.Errorf("Dot = %d, %v", got, err)
+			}
+			m := MeanVariance(xs, tt.opt)
+			if m.Count != 7 || math.Abs(m.Mean-9.0/7) > 1e-12 || math.Abs(m.Variance()-(273.0/7-81.0/49)) > 1e-9 {
+				t.Errorf("MeanVariance = %+v", m)
+			}
+		})
+	}
+	if _, err := Dot(xs, xs[1:], Options{}); !errors.Is(err, ErrLengthMismatch) {
+		t.Errorf("Dot of different lengths: %v", err)
+	}
+	if got := Min([]int64{}, Options{}); got.Index != -1 {
+		t.Errorf("Min of nothing = %+v", got)
+	}
+}
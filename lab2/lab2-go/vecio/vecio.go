@@ -0,0 +1,197 @@
+// Package vecio streams vectors from files without loading them into
+// memory.
+package vecio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Format string
+
+const (
+	// FormatText is numbers separated by any white space.
+	FormatText Format = "text"
+	// FormatCSV is one column of a CSV file.
+	FormatCSV Format = "csv"
+	// FormatInt64 and FormatFloat64 are little-endian binary values.
+	FormatInt64   Format = "int64"
+	FormatFloat64 Format = "float64"
+)
+
+// Element is a vector element type a file can be read into.
+type Element interface {
+	int64 | float64
+}
+
+// Reader reads a vector piece by piece.
+type Reader[T any] interface {
+	// Read fills buf with the next values and returns how many it read. At
+	// the end of the vector it returns io.EOF, possibly with n > 0.
+	Read(buf []T) (n int, err error)
+	Close() error
+}
+
+// Options describe how to read a file.
+type Options struct {
+	Format Format
+	// Column is the zero-based CSV column to read.
+	Column int
+	// Header skips the first CSV record.
+	Header bool
+}
+
+// Open starts reading the vector stored at path. Values of the other
+// element type are converted; float64 values read as int64 are truncated.
+func Open[T Element](path string, opt Options) (Reader[T], error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	in := bufio.NewReaderSize(file, 1<<16)
+	switch opt.Format {
+	case "", FormatText:
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 0, 1<<16), 1<<20)
+		scanner.Split(bufio.ScanWords)
+		return &textReader[T]{file: file, scanner: scanner}, nil
+	case FormatCSV:
+		records := csv.NewReader(in)
+		records.ReuseRecord = true
+		records.FieldsPerRecord = -1
+		r := &csvReader[T]{file: file, records: records, column: opt.Column}
+		if opt.Header {
+			if _, err := records.Read(); err != nil && err != io.EOF {
+				file.Close()
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		return r, nil
+	case FormatInt64, FormatFloat64:
+		return &binaryReader[T]{file: file, in: in, float: opt.Format == FormatFloat64}, nil
+	}
+	file.Close()
+	return nil, fmt.Errorf("unknown format %q", opt.Format)
+}
+
+func parse[T Element](field string) (T, error) {
+	var zero T
+	field = strings.TrimSpace(field)
+	if _, ok := any(zero).(float64); ok {
+		v, err := strconv.ParseFloat(field, 64)
+		return T(v), err
+	}
+	v, err := strconv.ParseInt(field, 10, 64)
+	return T(v), err
+}
+
+type textReader[T Element] struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	values  int
+}
+
+func (r *textReader[T]) Read(buf []T) (int, error) {
+	for n := range buf {
+		if !r.scanner.Scan() {
+			if err := r.scanner.Err(); err != nil {
+				return n, err
+			}
+			return n, io.EOF
+		}
+		v, err := parse[T](r.scanner.Text())
+		if err != nil {
+			return n, fmt.Errorf("value %d: %w", r.values+1, err)
+		}
+		buf[n] = v
+		r.values++
+	}
+	return len(buf), nil
+}
+
+func (r *textReader[T]) Close() error {
+	return r.file.Close()
+}
+
+type csvReader[T Element] struct {
+	file    *os.File
+	records *csv.Reader
+	column  int
+}
+
+func (r *csvReader[T]) Read(buf []T) (int, error) {
+	for n := range buf {
+		record, err := r.records.Read()
+		if err != nil {
+			return n, err
+		}
+		line, _ := r.records.FieldPos(0)
+		if r.column >= len(record) {
+			return n, fmt.Errorf("line %d: no column %d", line, r.column)
+		}
+		v, err := parse[T](record[r.column])
+		if err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+		buf[n] = v
+	}
+	return len(buf), nil
+}
+
+func (r *csvReader[T]) Close() error {
+	return r.file.Close()
+}
+
+type binaryReader[T Element] struct {
+	file  *os.File
+	in    *bufio.Reader
+	float bool
+	word  [8]byte
+}
+
+func (r *binaryReader[T]) Read(buf []T) (int, error) {
+	for n := range buf {
+		if _, err := io.ReadFull(r.in, r.word[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return n, errors.New("file ends in the middle of a value")
+			}
+			return n, err
+		}
+		bits := binary.LittleEndian.Uint64(r.word[:])
+		if r.float {
+			buf[n] = T(math.Float64frombits(bits))
+		} else {
+			buf[n] = T(int64(bits))
+		}
+	}
+	return len(buf), nil
+}
+
+func (r *binaryReader[T]) Close() error {
+	return r.file.Close()
+}
+
+// ReadFull reads until buf is full or the vector ends; it returns io.EOF
+// only if it read nothing.
+func ReadFull[T any](r Reader[T], buf []T) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err == io.EOF && n > 0 {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
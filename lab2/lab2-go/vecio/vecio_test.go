@@ -0,0 +1,193 @@
+package vecio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// long is a vector whose files are larger than the 64 KiB read buffer in
+// every format.
+var long = func() []int64 {
+	v := make([]int64, 20_000)
+	for i := range v {
+		v[i] = int64(i*7919%100_003 - 50_000)
+	}
+	return v
+}()
+
+func text(v []int64, sep string) string {
+	var b strings.Builder
+	for _, x := range v {
+		fmt.Fprint(&b, x, sep)
+	}
+	return b.String()
+}
+
+func binaryInt64(v []int64) string {
+	buf := make([]byte, 0, 8*len(v))
+	for _, x := range v {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(x))
+	}
+	return string(buf)
+}
+
+func binaryFloat64(v []float64) string {
+	buf := make([]byte, 0, 8*len(v))
+	for _, x := range v {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(x))
+	}
+	return string(buf)
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "vector")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readAll reads the whole vector chunk values at a time.
+func readAll[T Element](path string, opt Options, chunk int) ([]T, error) {
+	r, err := Open[T](path, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var values []T
+	buf := make([]T, chunk)
+	for {
+		n, err := ReadFull(r, buf)
+		values = append(values, buf[:n]...)
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return values, err
+		}
+		if n != len(buf) {
+			if n2, err := r.Read(buf); n2 != 0 || err != io.EOF {
+				return values, fmt.Errorf("short read of %d followed by %d values, %v", n, n2, err)
+			}
+			return values, nil
+		}
+	}
+}
+
+func TestReadInt64(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		opt     Options
+		want    []int64
+		fails   bool
+	}{
+		{name: "text", content: "1 -2\n3\t4\n\n5", want: []int64{1, -2, 3, 4, 5}},
+		{name: "text empty", content: " \n", want: nil},
+		{name: "text long", content: text(long, "\n"), want: long},
+		{name: "text bad value", content: "1 two 3", fails: true},
+		{name: "csv", content: "1,a\n2,b\n3,c\n", opt: Options{Format: FormatCSV}, want: []int64{1, 2, 3}},
+		{name: "csv column", content: "a, 1\nb, -2\n", opt: Options{Format: FormatCSV, Column: 1}, want: []int64{1, -2}},
+		{name: "csv header", content: "name,x\na,4\nb,5\n", opt: Options{Format: FormatCSV, Column: 1, Header: true}, want: []int64{4, 5}},
+		{name: "csv header only", content: "name,x\n", opt: Options{Format: FormatCSV, Header: true}, want: nil},
+		{name: "csv long", content: text(long, ",x\n"), opt: Options{Format: FormatCSV}, want: long},
+		{name: "csv missing column", content: "1,2\n3\n", opt: Options{Format: FormatCSV, Column: 1}, fails: true},
+		{name: "csv bad value", content: "1\nx\n", opt: Options{Format: FormatCSV}, fails: true},
+		{name: "int64", content: binaryInt64([]int64{1, -1, math.MaxInt64}), opt: Options{Format: FormatInt64}, want: []int64{1, -1, math.MaxInt64}},
+		{name: "int64 long", content: binaryInt64(long), opt: Options{Format: FormatInt64}, want: long},
+		{name: "int64 torn value", content: binaryInt64([]int64{1, 2})[:13], opt: Options{Format: FormatInt64}, fails: true},
+		{name: "float64 truncated", content: binaryFloat64([]float64{1.5, -2.5}), opt: Options{Format: FormatFloat64}, want: []int64{1, -2}},
+		{name: "unknown format", content: "1", opt: Options{Format: "xml"}, fails: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, tt.content)
+			for _, chunk := range []int{1, 3, 1024} {
+				got, err := readAll[int64](path, tt.opt, chunk)
+				if tt.fails {
+					if err == nil {
+						t.Fatalf("chunk %d: read %d values without error", chunk, len(got))
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("chunk %d: %v", chunk, err)
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Fatalf("chunk %d: got %d values, want %d", chunk, len(got), len(tt.want))
+				}
+			}
+		})
+	}
+}
+
+func TestReadFloat64(t *testing.T) {
+	want := []float64{0.5, -1e300, math.Inf(1), 3}
+	tests := []struct {
+		name    string
+		content string
+		opt     Options
+	}{
+		{"text", "0.5 -1e300 +Inf 3", Options{}},
+		{"csv", "x\n0.5\n-1e300\n+Inf\n3\n", Options{Format: FormatCSV, Header: true}},
+		{"float64", binaryFloat64(want), Options{Format: FormatFloat64}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readAll[float64](writeFile(t, tt.content), tt.opt, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+	// Binary int64 values read as float64 are converted.
+	got, err := readAll[float64](writeFile(t, binaryInt64([]int64{-3, 7})), Options{Format: FormatInt64}, 2)
+	if err != nil || !slices.Equal(got, []float64{-3, 7}) {
+		t.Errorf("int64 as float64: got %v, %v", got, err)
+	}
+}
+
+// trickle hands out at most two values per Read, like a reader that is
+// not done when it returns.
+type trickle struct {
+	values []int64
+}
+
+func (r *trickle) Read(buf []int64) (int, error) {
+	if len(r.values) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(buf[:min(len(buf), 2)], r.values)
+	r.values = r.values[n:]
+	if len(r.values) == 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *trickle) Close() error { return nil }
+
+func TestReadFull(t *testing.T) {
+	r := &trickle{values: []int64{1, 2, 3, 4, 5, 6, 7}}
+	buf := make([]int64, 5)
+	if n, err := ReadFull[int64](r, buf); n != 5 || err != nil || !slices.Equal(buf, []int64{1, 2, 3, 4, 5}) {
+		t.Fatalf("first read: %d %v %v", n, buf[:n], err)
+	}
+	if n, err := ReadFull[int64](r, buf); n != 2 || err != nil || !slices.Equal(buf[:n], []int64{6, 7}) {
+		t.Fatalf("second read: %d %v %v", n, buf[:n], err)
+	}
+	if n, err := ReadFull[int64](r, buf); n != 0 || err != io.EOF {
+		t.Fatalf("read at the end: %d, %v", n, err)
+	}
+}
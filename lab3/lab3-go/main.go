@@ -1,7 +1,10 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"lab3-go/matrix"
+	"log"
 	"math/rand"
 	"sync"
 	"time"
@@ -9,55 +12,67 @@ import (
 
 const MaxVal = 10
 
-type Matrix [][]int
+type Matrix = matrix.Matrix
 
-func computeElement(A, B, C Matrix, row, col, size, threadID int) {
+// computeElement sets C[row][col] to row row of A times column col of B.
+// It goes by the strides, so any of them may be a transposed view.
+func computeElement(A, B, C Matrix, row, col, threadID int) {
 	//fmt.Printf("Thread %d: computes C[%d][%d]\n", threadID, row, col)
+	aRow, aCol := A.Strides()
+	bRow, bCol := B.Strides()
+	a, b := row*aRow, col*bCol
 	sum := 0
-	for p := 0; p < size; p++ {
-		sum += A[row][p] * B[p][col]
+	for p := 0; p < A.Cols; p++ {
+		sum += A.Data[a+p*aCol] * B.Data[b+p*bRow]
 	}
-	C[row][col] = sum
+	C.Set(row, col, sum)
 }
 
-func workConsecutiveRow(A, B, C Matrix, size, startIdx, endIdx, threadID int, wg *sync.WaitGroup) {
+// The strategies number the elements of C from 0 to C.Rows*C.Cols and
+// compute those in [startIdx, endIdx), or every nrThreads-th one from
+// startIdx.
+
+func workConsecutiveRow(A, B, C Matrix, startIdx, endIdx, threadID int, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for I := startIdx; I < endIdx; I++ {
-		row := I / size
-		col := I % size
+		row := I / C.Cols
+		col := I % C.Cols
 
-		computeElement(A, B, C, row, col, size, threadID)
+		computeElement(A, B, C, row, col, threadID)
 	}
 }
 
-func workConsecutiveCol(A, B, C Matrix, size, startIdx, endIdx, threadID int, wg *sync.WaitGroup) {
+func workConsecutiveCol(A, B, C Matrix, startIdx, endIdx, threadID int, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for I := startIdx; I < endIdx; I++ {
-		col := I / size
-		row := I % size
+		col := I / C.Rows
+		row := I % C.Rows
 
-		computeElement(A, B, C, row, col, size, threadID)
+		computeElement(A, B, C, row, col, threadID)
 	}
 }
 
-func workInterleavedRow(A, B, C Matrix, size, startIdx, nrThreads, threadID int, wg *sync.WaitGroup) {
+func workInterleavedRow(A, B, C Matrix, startIdx, nrThreads, threadID int, wg *sync.WaitGroup) {
 	defer wg.Done()
-	totalElements := size * size
+	totalElements := C.Rows * C.Cols
 
 	for I := startIdx; I < totalElements; I += nrThreads {
-		row := I / size
-		col := I % size
+		row := I / C.Cols
+		col := I % C.Cols
 
-		computeElement(A, B, C, row, col, size, threadID)
+		computeElement(A, B, C, row, col, threadID)
 	}
 }
 
-type workStrategy func(A, B, C Matrix, size, startIdx, endIdx, threadID int, wg *sync.WaitGroup)
+type workStrategy func(A, B, C Matrix, startIdx, endIdx, threadID int, wg *sync.WaitGroup)
 
-func parallelMultiplyManager(A, B, C Matrix, size, numThreads int, strategy workStrategy) {
-	totalElements := size * size
+func parallelMultiplyManager(A, B, C Matrix, numThreads int, strategy workStrategy) error {
+	if err := matrix.CheckProduct(A, B, C); err != nil {
+		return err
+	}
+	totalElements := C.Rows * C.Cols
 	baseWork := totalElements / numThreads
 	remainder := totalElements % numThreads
 
@@ -73,67 +88,98 @@ func parallelMultiplyManager(A, B, C Matrix, size, numThreads int, strategy work
 		endIdx := currentStartIdx + workSize
 
 		wg.Add(1)
-		go strategy(A, B, C, size, currentStartIdx, endIdx, i, &wg)
+		go strategy(A, B, C, currentStartIdx, endIdx, i, &wg)
 		currentStartIdx = endIdx
 	}
 
 	wg.Wait()
+	return nil
 }
 
-func parallelMultiplyInterleavedManager(A, B, C Matrix, size, numThreads int) {
+func parallelMultiplyInterleavedManager(A, B, C Matrix, numThreads int) error {
+	if err := matrix.CheckProduct(A, B, C); err != nil {
+		return err
+	}
 	var wg sync.WaitGroup
 
 	for i := 0; i < numThreads; i++ {
 		wg.Add(1)
-		go workInterleavedRow(A, B, C, size, i, numThreads, i, &wg)
+		go workInterleavedRow(A, B, C, i, numThreads, i, &wg)
 	}
 
 	wg.Wait()
+	return nil
 }
 
-func newMatrix(size int) Matrix {
-	matrix := make(Matrix, size)
-	for i := 0; i < size; i++ {
-		matrix[i] = make([]int, size)
-		for j := 0; j < size; j++ {
-			matrix[i][j] = rand.Intn(MaxVal)
-		}
-	}
-	return matrix
-}
-
-func zeroMatrix(size int) Matrix {
-	matrix := make(Matrix, size)
-	for i := 0; i < size; i++ {
-		matrix[i] = make([]int, size)
-	}
-	return matrix
+func newMatrix(rows, cols int) Matrix {
+	m := matrix.New(rows, cols)
+	m.Fill(func(int, int) int { return rand.Intn(MaxVal) })
+	return m
 }
 
 func main() {
-
-	matrixSize := 3000
-	nrThreads := 100
+	rows := flag.Int("rows", 3000, "rows of A and C")
+	inner := flag.Int("inner", 3000, "columns of A and rows of B")
+	cols := flag.Int("cols", 3000, "columns of B and C")
+	nrThreads := flag.Int("threads", 100, "number of goroutines")
+	tileRows := flag.Int("tile-rows", 64, "rows of the C tiles of the tiled strategies")
+	tileCols := flag.Int("tile-cols", 64, "columns of the C tiles of the tiled strategies")
+	tileK := flag.Int("tile-k", 256, "inner dimension block of the tiled strategies")
+	flag.Parse()
+	if *nrThreads < 1 {
+		log.Fatal("-threads must be at least 1")
+	}
+	tiles := Tiles{Rows: *tileRows, Cols: *tileCols, K: *tileK}
+	if err := tiles.validate(); err != nil {
+		log.Fatal(err)
+	}
 
 	rand.Seed(time.Now().UnixNano())
-	A := newMatrix(matrixSize)
-	B := newMatrix(matrixSize)
+	A := newMatrix(*rows, *inner)
+	B := newMatrix(*inner, *cols)
+	fmt.Printf("%dx%d times %dx%d with %d threads\n", A.Rows, A.Cols, B.Rows, B.Cols, *nrThreads)
 
-	C1 := zeroMatrix(matrixSize)
+	C1 := matrix.New(*rows, *cols)
 	start := time.Now()
-	parallelMultiplyManager(A, B, C1, matrixSize, nrThreads, workConsecutiveRow)
+	if err := parallelMultiplyManager(A, B, C1, *nrThreads, workConsecutiveRow); err != nil {
+		log.Fatal(err)
+	}
 	elapsed := time.Since(start)
 	fmt.Printf("Strategy 1 (Consecutive Row-Major): %v\n", elapsed)
 
-	C2 := zeroMatrix(matrixSize)
+	C2 := matrix.New(*rows, *cols)
 	start = time.Now()
-	parallelMultiplyManager(A, B, C2, matrixSize, nrThreads, workConsecutiveCol)
+	if err := parallelMultiplyManager(A, B, C2, *nrThreads, workConsecutiveCol); err != nil {
+		log.Fatal(err)
+	}
 	elapsed = time.Since(start)
 	fmt.Printf("Strategy 2 (Consecutive Col-Major): %v\n", elapsed)
 
-	C3 := zeroMatrix(matrixSize)
+	C3 := matrix.New(*rows, *cols)
 	start = time.Now()
-	parallelMultiplyInterleavedManager(A, B, C3, matrixSize, nrThreads)
+	if err := parallelMultiplyInterleavedManager(A, B, C3, *nrThreads); err != nil {
+		log.Fatal(err)
+	}
 	elapsed = time.Since(start)
 	fmt.Printf("Strategy 3 (Interleaved Row-Major): %v\n", elapsed)
+
+	C4 := matrix.New(*rows, *cols)
+	start = time.Now()
+	if err := parallelMultiplyTiledManager(A, B, C4, *nrThreads, tiles, false); err != nil {
+		log.Fatal(err)
+	}
+	elapsed = time.Since(start)
+	fmt.Printf("Strategy 4 (Tiled %dx%d, k-blocks of %d): %v\n", tiles.Rows, tiles.Cols, tiles.K, elapsed)
+
+	C5 := matrix.New(*rows, *cols)
+	start = time.Now()
+	if err := parallelMultiplyTiledManager(A, B, C5, *nrThreads, tiles, true); err != nil {
+		log.Fatal(err)
+	}
+	elapsed = time.Since(start)
+	fmt.Printf("Strategy 5 (Tiled %dx%d, k-blocks of %d, transposed B): %v\n", tiles.Rows, tiles.Cols, tiles.K, elapsed)
+
+	if !C2.Equal(C1) || !C3.Equal(C1) || !C4.Equal(C1) || !C5.Equal(C1) {
+		log.Fatal("strategies disagree on the product")
+	}
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"lab3-go/matrix"
+	"testing"
+)
+
+func naiveProduct(A, B Matrix) Matrix {
+	C := matrix.New(A.Rows, B.Cols)
+	for i := 0; i < A.Rows; i++ {
+		for j := 0; j < B.Cols; j++ {
+			sum := 0
+			for k := 0; k < A.Cols; k++ {
+				sum += A.At(i, k) * B.At(k, j)
+			}
+			C.Set(i, j, sum)
+		}
+	}
+	return C
+}
+
+func TestStrategies(t *testing.T) {
+	shapes := []struct {
+		rows, inner, cols int
+	}{
+		{1, 1, 1},
+		{7, 7, 7},
+		{31, 17, 45},
+		{64, 100, 3},
+		{3, 1, 90},
+	}
+	tiles := []Tiles{{1, 1, 1}, {8, 8, 8}, {5, 13, 7}, {64, 64, 256}, {100, 2, 3}}
+	for _, s := range shapes {
+		for _, transposed := range []bool{false, true} {
+			// take A, B and C as views of bigger matrices, so strides differ
+			// from the widths, and with transposed as transposed views
+			view := func(outer Matrix, i, j, rows, cols int) Matrix {
+				return outer.View(i, j, rows, cols)
+			}
+			size := func(rows, cols int) Matrix { return newMatrix(rows, cols) }
+			if transposed {
+				view = func(outer Matrix, i, j, rows, cols int) Matrix {
+					return outer.Transpose().View(i, j, rows, cols)
+				}
+				size = func(rows, cols int) Matrix { return newMatrix(cols, rows) }
+			}
+			A := view(size(s.rows+2, s.inner+3), 1, 2, s.rows, s.inner)
+			B := view(size(s.inner+1, s.cols+4), 1, 3, s.inner, s.cols)
+			want := naiveProduct(A, B)
+
+			for _, threads := range []int{1, 3, 16} {
+				run := map[string]func(C Matrix) error{
+					"consecutive row": func(C Matrix) error { return parallelMultiplyManager(A, B, C, threads, workConsecutiveRow) },
+					"consecutive col": func(C Matrix) error { return parallelMultiplyManager(A, B, C, threads, workConsecutiveCol) },
+					"interleaved row": func(C Matrix) error { return parallelMultiplyInterleavedManager(A, B, C, threads) },
+				}
+				for _, tile := range tiles {
+					run[fmt.Sprintf("tiled %v", tile)] = func(C Matrix) error {
+						return parallelMultiplyTiledManager(A, B, C, threads, tile, false)
+					}
+					run[fmt.Sprintf("tiled transposed %v", tile)] = func(C Matrix) error {
+						return parallelMultiplyTiledManager(A, B, C, threads, tile, true)
+					}
+				}
+				for name, multiply := range run {
+					// write into a view of a dirty matrix: the strategies must
+					// overwrite C, and nothing around it
+					outer := size(s.rows+2, s.cols+2)
+					before := outer.Clone()
+					C := view(outer, 1, 1, s.rows, s.cols)
+					if err := multiply(C); err != nil {
+						t.Fatalf("%s, %+v, transposed %v, %d threads: %v", name, s, transposed, threads, err)
+					}
+					if !C.Equal(want) {
+						t.Errorf("%s, %+v, transposed %v, %d threads: wrong product", name, s, transposed, threads)
+					}
+					orig := view(before, 1, 1, s.rows, s.cols)
+					C.Fill(orig.At)
+					if !outer.Equal(before) {
+						t.Errorf("%s, %+v, transposed %v, %d threads: wrote outside C", name, s, transposed, threads)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestShapeAndTileErrors(t *testing.T) {
+	A, B := matrix.New(2, 3), matrix.New(3, 4)
+	if err := parallelMultiplyManager(A, B, matrix.New(3, 4), 2, workConsecutiveRow); err == nil {
+		t.Error("wrong result shape accepted")
+	}
+	if err := parallelMultiplyTiledManager(A, A, matrix.New(2, 3), 2, Tiles{4, 4, 4}, false); err == nil {
+		t.Error("wrong inner dimension accepted")
+	}
+	if err := parallelMultiplyTiledManager(A, B, matrix.New(2, 4), 2, Tiles{4, 0, 4}, true); err == nil {
+		t.Error("empty tiles accepted")
+	}
+}
@@ -0,0 +1,201 @@
+// Package matrix is a dense matrix of ints stored row-major in one flat
+// slice, so a row is contiguous in memory and a sub-matrix or the transpose
+// is a view on the same storage.
+package matrix
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrShape = errors.New("matrix shapes do not match")
+
+// Matrix is a rows x cols matrix whose element (i, j) is
+// Data[i*Stride+j]. A matrix of its own has Stride == Cols; a view keeps
+// the stride of the matrix it was taken from. A transposed view (see
+// Transpose) keeps its columns where the matrix it was taken from keeps
+// rows, so its element (i, j) is Data[j*Stride+i]; Strides covers both.
+type Matrix struct {
+	Rows, Cols int
+	Stride     int
+	Data       []int
+	transposed bool
+}
+
+// New returns a zero rows x cols matrix.
+func New(rows, cols int) Matrix {
+	if rows < 0 || cols < 0 {
+		panic(fmt.Sprintf("matrix: negative shape %dx%d", rows, cols))
+	}
+	return Matrix{Rows: rows, Cols: cols, Stride: cols, Data: make([]int, rows*cols)}
+}
+
+// FromRows copies rows, which must all have the same length, into a new
+// matrix.
+func FromRows(rows [][]int) Matrix {
+	cols := 0
+	if len(rows) > 0 {
+		cols = len(rows[0])
+	}
+	m := New(len(rows), cols)
+	for i, row := range rows {
+		if len(row) != cols {
+			panic(fmt.Sprintf("matrix: row %d has %d columns, want %d", i, len(row), cols))
+		}
+		copy(m.Row(i), row)
+	}
+	return m
+}
+
+func (m Matrix) At(i, j int) int {
+	m.check(i, j)
+	return m.Data[m.offset(i, j)]
+}
+
+func (m Matrix) Set(i, j, v int) {
+	m.check(i, j)
+	m.Data[m.offset(i, j)] = v
+}
+
+func (m Matrix) offset(i, j int) int {
+	if m.transposed {
+		return j*m.Stride + i
+	}
+	return i*m.Stride + j
+}
+
+// Strides returns how far apart in Data the elements of a column (row) and
+// of a row (col) are: element (i, j) is Data[i*row+j*col].
+func (m Matrix) Strides() (row, col int) {
+	if m.transposed {
+		return 1, m.Stride
+	}
+	return m.Stride, 1
+}
+
+// Transposed reports whether m is a transposed view, whose rows are not
+// contiguous.
+func (m Matrix) Transposed() bool {
+	return m.transposed
+}
+
+func (m Matrix) check(i, j int) {
+	if uint(i) >= uint(m.Rows) || uint(j) >= uint(m.Cols) {
+		panic(fmt.Sprintf("matrix: index (%d, %d) out of range for %dx%d", i, j, m.Rows, m.Cols))
+	}
+}
+
+// Row returns row i as a slice of the matrix storage; it cannot be grown
+// into the next row. It panics on a transposed view, whose rows are spread
+// over the storage: Clone one first, or use At.
+func (m Matrix) Row(i int) []int {
+	if uint(i) >= uint(m.Rows) {
+		panic(fmt.Sprintf("matrix: row %d out of range for %dx%d", i, m.Rows, m.Cols))
+	}
+	if m.transposed {
+		panic("matrix: Row of a transposed view")
+	}
+	start := i * m.Stride
+	return m.Data[start : start+m.Cols : start+m.Cols]
+}
+
+// View returns the rows x cols sub-matrix whose top-left element is (i, j).
+// It shares the storage of m: writes through either are seen by both.
+func (m Matrix) View(i, j, rows, cols int) Matrix {
+	if i < 0 || j < 0 || rows < 0 || cols < 0 || i+rows > m.Rows || j+cols > m.Cols {
+		panic(fmt.Sprintf("matrix: view %dx%d at (%d, %d) out of range for %dx%d", rows, cols, i, j, m.Rows, m.Cols))
+	}
+	v := Matrix{Rows: rows, Cols: cols, Stride: m.Stride, transposed: m.transposed}
+	if rows > 0 && cols > 0 {
+		start := m.offset(i, j)
+		end := m.offset(i+rows-1, j+cols-1) + 1
+		v.Data = m.Data[start:end:end]
+	}
+	return v
+}
+
+// Contiguous reports whether the rows follow each other without gaps, as
+// they do in a matrix of its own.
+func (m Matrix) Contiguous() bool {
+	if m.transposed {
+		return m.Rows*m.Cols <= 1
+	}
+	return m.Stride == m.Cols || m.Rows <= 1
+}
+
+// Transpose returns the cols x rows transpose of m as a view on the same
+// storage, like View: row i of the transpose is column i of m. Transposing
+// a transposed view gives back a plain one.
+func (m Matrix) Transpose() Matrix {
+	t := m
+	t.Rows, t.Cols = m.Cols, m.Rows
+	t.transposed = !m.transposed
+	return t
+}
+
+// transposeBlock is the side of the square blocks Clone copies a
+// transposed view in, so both the rows read and the rows written stay in
+// cache.
+const transposeBlock = 32
+
+// Clone returns a copy of m with storage of its own and contiguous rows.
+// Cloning a transposed view is what lays its rows out one after another,
+// at O(rows*cols) against the O(rows*cols*inner) of a product.
+func (m Matrix) Clone() Matrix {
+	c := New(m.Rows, m.Cols)
+	if !m.transposed {
+		for i := 0; i < m.Rows; i++ {
+			copy(c.Row(i), m.Row(i))
+		}
+		return c
+	}
+	// Row i of c is column i of the rows m.Data holds.
+	for j0 := 0; j0 < m.Cols; j0 += transposeBlock {
+		j1 := min(j0+transposeBlock, m.Cols)
+		for i0 := 0; i0 < m.Rows; i0 += transposeBlock {
+			i1 := min(i0+transposeBlock, m.Rows)
+			for j := j0; j < j1; j++ {
+				src := m.Data[j*m.Stride:]
+				for i := i0; i < i1; i++ {
+					c.Data[i*c.Stride+j] = src[i]
+				}
+			}
+		}
+	}
+	return c
+}
+
+// Equal reports whether m and o have the same shape and elements.
+func (m Matrix) Equal(o Matrix) bool {
+	if m.Rows != o.Rows || m.Cols != o.Cols {
+		return false
+	}
+	mr, mc := m.Strides()
+	or, oc := o.Strides()
+	for i := 0; i < m.Rows; i++ {
+		for j := 0; j < m.Cols; j++ {
+			if m.Data[i*mr+j*mc] != o.Data[i*or+j*oc] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Fill sets every element (i, j) to f(i, j), row by row.
+func (m Matrix) Fill(f func(i, j int) int) {
+	rs, cs := m.Strides()
+	for i := 0; i < m.Rows; i++ {
+		for j := 0; j < m.Cols; j++ {
+			m.Data[i*rs+j*cs] = f(i, j)
+		}
+	}
+}
+
+// CheckProduct reports whether c can hold the product of a and b.
+func CheckProduct(a, b, c Matrix) error {
+	if a.Cols != b.Rows || c.Rows != a.Rows || c.Cols != b.Cols {
+		return fmt.Errorf("%w: %dx%d times %dx%d into %dx%d", ErrShape, a.Rows, a.Cols, b.Rows, b.Cols, c.Rows, c.Cols)
+	}
+	return nil
+}
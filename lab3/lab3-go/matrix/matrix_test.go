@@ -0,0 +1,135 @@
+package matrix
+
+import "testing"
+
+func sequential(rows, cols int) Matrix {
+	m := New(rows, cols)
+	m.Fill(func(i, j int) int { return i*100 + j })
+	return m
+}
+
+func TestView(t *testing.T) {
+	m := sequential(5, 7)
+	tests := []struct {
+		i, j, rows, cols int
+	}{
+		{0, 0, 5, 7},
+		{1, 2, 3, 4},
+		{4, 6, 1, 1},
+		{2, 3, 0, 2},
+		{0, 5, 5, 2},
+	}
+	for _, tt := range tests {
+		v := m.View(tt.i, tt.j, tt.rows, tt.cols)
+		if v.Rows != tt.rows || v.Cols != tt.cols || v.Stride != m.Stride {
+			t.Fatalf("%+v: view is %dx%d with stride %d", tt, v.Rows, v.Cols, v.Stride)
+		}
+		for i := 0; i < v.Rows; i++ {
+			if len(v.Row(i)) != v.Cols || cap(v.Row(i)) != v.Cols {
+				t.Fatalf("%+v: row %d has len %d, cap %d", tt, i, len(v.Row(i)), cap(v.Row(i)))
+			}
+			for j := 0; j < v.Cols; j++ {
+				if got, want := v.At(i, j), m.At(tt.i+i, tt.j+j); got != want {
+					t.Fatalf("%+v: (%d, %d) = %d, want %d", tt, i, j, got, want)
+				}
+			}
+		}
+	}
+
+	v := m.View(1, 2, 2, 2)
+	v.Set(1, 1, -1)
+	if m.At(2, 3) != -1 {
+		t.Error("a write through a view is not seen by the matrix")
+	}
+	if v.Contiguous() || !v.Clone().Contiguous() || !v.Clone().Equal(v) {
+		t.Error("Clone of a view is not a contiguous copy")
+	}
+}
+
+func TestViewOutOfRange(t *testing.T) {
+	m := New(3, 3)
+	for _, tt := range [][4]int{{-1, 0, 1, 1}, {0, 0, 4, 1}, {2, 2, 1, 2}, {0, 0, -1, 1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("View%v did not panic", tt)
+				}
+			}()
+			m.View(tt[0], tt[1], tt[2], tt[3])
+		}()
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	for _, shape := range [][2]int{{1, 1}, {3, 5}, {33, 70}, {64, 31}, {0, 4}} {
+		m := sequential(shape[0], shape[1])
+		for _, src := range []Matrix{m, m.View(0, min(1, m.Cols), m.Rows, max(m.Cols-1, 0))} {
+			tr := src.Transpose()
+			if tr.Rows != src.Cols || tr.Cols != src.Rows || !tr.Transposed() {
+				t.Fatalf("%v: transpose is %dx%d", shape, tr.Rows, tr.Cols)
+			}
+			for i := 0; i < src.Rows; i++ {
+				for j := 0; j < src.Cols; j++ {
+					if tr.At(j, i) != src.At(i, j) {
+						t.Fatalf("%v: transpose (%d, %d) = %d, want %d", shape, j, i, tr.At(j, i), src.At(i, j))
+					}
+				}
+			}
+			back := tr.Transpose()
+			if back.Transposed() || !back.Equal(src) {
+				t.Errorf("%v: transposing twice changed the matrix", shape)
+			}
+			c := tr.Clone()
+			if c.Transposed() || !c.Contiguous() || !c.Equal(tr) {
+				t.Errorf("%v: Clone of a transpose is not a contiguous copy", shape)
+			}
+		}
+	}
+}
+
+func TestTransposeView(t *testing.T) {
+	m := sequential(5, 7)
+	tr := m.Transpose()
+	// The transpose shares the storage of m, both ways.
+	tr.Set(6, 4, -1)
+	m.Set(0, 1, -2)
+	if m.At(4, 6) != -1 || tr.At(1, 0) != -2 {
+		t.Error("the transpose does not share the storage of the matrix")
+	}
+	if len(tr.Data) != len(m.Data) || &tr.Data[0] != &m.Data[0] {
+		t.Error("Transpose copied the storage")
+	}
+	if rows, cols := tr.Strides(); rows != 1 || cols != m.Stride {
+		t.Errorf("transpose strides %d, %d", rows, cols)
+	}
+
+	// A view of the transpose is the transpose of a view.
+	v := tr.View(2, 1, 3, 4)
+	if !v.Transposed() || !v.Equal(m.View(1, 2, 4, 3).Transpose()) {
+		t.Error("a view of the transpose differs from the transpose of a view")
+	}
+	v.Fill(func(i, j int) int { return -(i*10 + j) })
+	if m.At(1+3, 2+2) != -23 || m.At(0, 2) != 2 {
+		t.Error("Fill through a view of the transpose wrote the wrong elements")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Row of a transposed view did not panic")
+		}
+	}()
+	tr.Row(0)
+}
+
+func TestCheckProduct(t *testing.T) {
+	a, b := New(2, 3), New(3, 4)
+	if err := CheckProduct(a, b, New(2, 4)); err != nil {
+		t.Error(err)
+	}
+	if err := CheckProduct(a, b, New(4, 2)); err == nil {
+		t.Error("wrong result shape accepted")
+	}
+	if err := CheckProduct(a, a, New(2, 3)); err == nil {
+		t.Error("wrong inner dimension accepted")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"lab3-go/matrix"
+	"sync"
+)
+
+// Tiles is how the tiled strategies block the product: C is cut into
+// Rows x Cols tiles and every tile is accumulated K columns of A (and rows
+// of B) at a time, so the slices of A, B and C in use stay in cache.
+type Tiles struct {
+	Rows, Cols, K int
+}
+
+func (t Tiles) validate() error {
+	if t.Rows < 1 || t.Cols < 1 || t.K < 1 {
+		return fmt.Errorf("tile sizes must be positive, got %dx%d by %d", t.Rows, t.Cols, t.K)
+	}
+	return nil
+}
+
+// workTiled computes every nrThreads-th tile of C from startIdx, tiles
+// being numbered row by row. The inner loop walks a row of B, so B is read
+// sequentially instead of down its columns.
+func workTiled(A, B, C Matrix, tiles Tiles, startIdx, nrThreads, threadID int, wg *sync.WaitGroup) {
+	defer wg.Done()
+	tileCols := (C.Cols + tiles.Cols - 1) / tiles.Cols
+	totalTiles := (C.Rows + tiles.Rows - 1) / tiles.Rows * tileCols
+
+	for I := startIdx; I < totalTiles; I += nrThreads {
+		r0, c0 := I/tileCols*tiles.Rows, I%tileCols*tiles.Cols
+		r1, c1 := min(r0+tiles.Rows, C.Rows), min(c0+tiles.Cols, C.Cols)
+		for i := r0; i < r1; i++ {
+			clear(C.Row(i)[c0:c1])
+		}
+
+		for k0 := 0; k0 < A.Cols; k0 += tiles.K {
+			k1 := min(k0+tiles.K, A.Cols)
+			for i := r0; i < r1; i++ {
+				c := C.Row(i)[c0:c1]
+				for p, a := range A.Row(i)[k0:k1] {
+					b := B.Row(k0 + p)[c0:c1]
+					for j, v := range b {
+						c[j] += a * v
+					}
+				}
+			}
+		}
+	}
+}
+
+// workTiledTransposed is workTiled with BT, the transpose of B: every
+// element of a tile is then a dot product of two contiguous rows.
+func workTiledTransposed(A, BT, C Matrix, tiles Tiles, startIdx, nrThreads, threadID int, wg *sync.WaitGroup) {
+	defer wg.Done()
+	tileCols := (C.Cols + tiles.Cols - 1) / tiles.Cols
+	totalTiles := (C.Rows + tiles.Rows - 1) / tiles.Rows * tileCols
+
+	for I := startIdx; I < totalTiles; I += nrThreads {
+		r0, c0 := I/tileCols*tiles.Rows, I%tileCols*tiles.Cols
+		r1, c1 := min(r0+tiles.Rows, C.Rows), min(c0+tiles.Cols, C.Cols)
+		for i := r0; i < r1; i++ {
+			clear(C.Row(i)[c0:c1])
+		}
+
+		for k0 := 0; k0 < A.Cols; k0 += tiles.K {
+			k1 := min(k0+tiles.K, A.Cols)
+			for i := r0; i < r1; i++ {
+				a := A.Row(i)[k0:k1]
+				c := C.Row(i)
+				for j := c0; j < c1; j++ {
+					b := BT.Row(j)[k0:k1]
+					sum := 0
+					for p, v := range a {
+						sum += v * b[p]
+					}
+					c[j] += sum
+				}
+			}
+		}
+	}
+}
+
+// parallelMultiplyTiledManager splits C into tiles dealt round-robin to
+// numThreads goroutines. With transposeB, B is transposed and copied so the
+// columns of B are contiguous, which is counted in the time of the
+// multiplication. The tiles work on rows, so a transposed view among the
+// operands is cloned first, and a transposed C is filled as the product
+// of the transposes of B and A.
+func parallelMultiplyTiledManager(A, B, C Matrix, numThreads int, tiles Tiles, transposeB bool) error {
+	if err := matrix.CheckProduct(A, B, C); err != nil {
+		return err
+	}
+	if err := tiles.validate(); err != nil {
+		return err
+	}
+	if C.Transposed() {
+		A, B, C = B.Transpose(), A.Transpose(), C.Transpose()
+		tiles.Rows, tiles.Cols = tiles.Cols, tiles.Rows
+	}
+	if A.Transposed() {
+		A = A.Clone()
+	}
+	work := workTiled
+	if transposeB {
+		B = B.Transpose()
+		work = workTiledTransposed
+	}
+	if B.Transposed() {
+		B = B.Clone()
+	}
+	var wg sync.WaitGroup
+
+	for i := 0; i < numThreads; i++ {
+		wg.Add(1)
+		go work(A, B, C, tiles, i, numThreads, i, &wg)
+	}
+
+	wg.Wait()
+	return nil
+}